@@ -0,0 +1,291 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// CertificateConditionReady indicates that the certificate is issued and stored in the secret.
+	CertificateConditionReady = "Ready"
+)
+
+// Reasons of the certificate Ready condition.
+const (
+	CertificateReasonIssued        = "Issued"
+	CertificateReasonRenewed       = "Renewed"
+	CertificateReasonPending       = "Pending"
+	CertificateReasonFailed        = "Failed"
+	CertificateReasonRateLimited   = "RateLimited"
+	CertificateReasonIssuerMissing = "IssuerNotFound"
+	// CertificateReasonIssuerNotReady indicates that the account of the issuer isn't registered yet.
+	CertificateReasonIssuerNotReady = "IssuerNotReady"
+	// CertificateReasonValidationFailed indicates that the ACME server couldn't validate a challenge.
+	CertificateReasonValidationFailed = "ValidationFailed"
+	// CertificateReasonRejected indicates that the ACME server refuses to issue for the domains.
+	CertificateReasonRejected = "Rejected"
+	// CertificateReasonSelfCheckFailed indicates that the challenge isn't served, the ACME server wasn't asked to validate it.
+	CertificateReasonSelfCheckFailed = "SelfCheckFailed"
+)
+
+// Workload kinds certificates can be injected into.
+const (
+	WorkloadKindDeployment  = "Deployment"
+	WorkloadKindStatefulSet = "StatefulSet"
+	WorkloadKindDaemonSet   = "DaemonSet"
+	WorkloadKindJob         = "Job"
+	WorkloadKindCronJob     = "CronJob"
+	WorkloadKindPod         = "Pod"
+)
+
+// Rollout policies of the target workloads when the certificate is issued or renewed.
+const (
+	// RolloutPolicyNone leaves it to the workloads to read the updated secret volume.
+	RolloutPolicyNone = "None"
+	// RolloutPolicyRestart stamps the hash of the certificate into the pod template, which rolls out the workload.
+	RolloutPolicyRestart = "Restart"
+	// RolloutPolicySignal adds a sidecar which sends SIGHUP to a process of the pod when the certificate changes.
+	RolloutPolicySignal = "Signal"
+)
+
+// Private key algorithms of certificates.
+const (
+	PrivateKeyAlgorithmRSA     = "RSA"
+	PrivateKeyAlgorithmECDSA   = "ECDSA"
+	PrivateKeyAlgorithmEd25519 = "Ed25519"
+)
+
+// Rotation policies of the private key when the certificate is renewed.
+const (
+	// RotationPolicyNever reuses the private key as long as it matches the algorithm and size.
+	RotationPolicyNever = "Never"
+	// RotationPolicyAlways generates a new private key for every renewal.
+	RotationPolicyAlways = "Always"
+)
+
+// CertificateSpec defines the desired state of Certificate
+type CertificateSpec struct {
+	// Domains is the list of DNS names the certificate is issued for.
+	//+kubebuilder:validation:MinItems=1
+	Domains []string `json:"domains"`
+	// IssuerRef references the issuer which is used to obtain the certificate.
+	// The default cluster issuer of the controller is used if it's not set.
+	//+optional
+	IssuerRef *IssuerReference `json:"issuerRef,omitempty"`
+	// SecretName is the name of the secret the issued certificate is stored in.
+	SecretName string `json:"secretName"`
+	// SecretTemplate defines labels and annotations of the secret.
+	//+optional
+	SecretTemplate *CertificateSecretTemplate `json:"secretTemplate,omitempty"`
+	// OwnSecret sets the certificate as owner of the secret, so the secret is deleted with the certificate.
+	// Certificates created for annotated services are deleted with the service.
+	//+optional
+	OwnSecret bool `json:"ownSecret,omitempty"`
+	// PrivateKey defines the algorithm, size and rotation of the private key of the certificate.
+	//+optional
+	PrivateKey *CertificatePrivateKey `json:"privateKey,omitempty"`
+	// MustStaple requests the OCSP must-staple extension in the certificate, clients reject it without
+	// a stapled OCSP response. It's ignored for certificates of a CSR.
+	//+optional
+	MustStaple bool `json:"mustStaple,omitempty"`
+	// CSR issues the certificate for a certificate signing request of an externally held private key.
+	// Only the certificate chain is written to the secret, PrivateKey is ignored.
+	//+optional
+	CSR *CertificateSigningRequest `json:"csr,omitempty"`
+	// ServiceName is the name of the service which exposes the HTTP-01 challenge solver.
+	// It's not required if the issuer solves challenges with DNS-01.
+	//+optional
+	ServiceName string `json:"serviceName,omitempty"`
+	// Targets is the list of workloads the issued certificate is injected into.
+	//+optional
+	Targets []WorkloadReference `json:"targets,omitempty"`
+	// RolloutPolicy defines how the target workloads pick up a renewed certificate.
+	// Pods and jobs can't be restarted, they always use None.
+	//+kubebuilder:validation:Enum=None;Restart;Signal
+	//+kubebuilder:default=None
+	//+optional
+	RolloutPolicy string `json:"rolloutPolicy,omitempty"`
+	// SignalProcess is the name of the process which gets SIGHUP with the Signal rollout policy.
+	//+optional
+	SignalProcess string `json:"signalProcess,omitempty"`
+	// Keystores adds PKCS#12 and JKS keystores of the certificate to the secret.
+	//+optional
+	Keystores *CertificateKeystores `json:"keystores,omitempty"`
+	// AdditionalOutputFormats adds further encodings of the certificate to the secret.
+	//+optional
+	AdditionalOutputFormats []CertificateOutputFormat `json:"additionalOutputFormats,omitempty"`
+	// RenewBefore is the duration before the expiration at which the certificate is renewed.
+	// It's ignored if it isn't shorter than the lifetime of the certificate.
+	//+optional
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+	// RenewBeforePercentage is the percentage of the lifetime before the expiration at which
+	// the certificate is renewed, if RenewBefore isn't set. Defaults to 33.
+	//+kubebuilder:validation:Minimum=1
+	//+kubebuilder:validation:Maximum=99
+	//+optional
+	RenewBeforePercentage *int32 `json:"renewBeforePercentage,omitempty"`
+}
+
+// IssuerReference references an issuer by kind and name.
+type IssuerReference struct {
+	// Name of the issuer.
+	Name string `json:"name"`
+	// Kind of the issuer, either Issuer or ClusterIssuer.
+	//+kubebuilder:validation:Enum=Issuer;ClusterIssuer
+	//+kubebuilder:default=Issuer
+	//+optional
+	Kind string `json:"kind,omitempty"`
+}
+
+// WorkloadReference references a workload in the namespace of the certificate.
+type WorkloadReference struct {
+	// Kind of the workload.
+	//+kubebuilder:validation:Enum=Deployment;StatefulSet;DaemonSet;Job;CronJob;Pod
+	//+kubebuilder:default=Deployment
+	//+optional
+	Kind string `json:"kind,omitempty"`
+	// Name of the workload.
+	Name string `json:"name"`
+}
+
+// CertificateSecretTemplate defines the metadata of the secret of a certificate.
+type CertificateSecretTemplate struct {
+	// Labels of the secret.
+	//+optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations of the secret.
+	//+optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// CertificatePrivateKey defines the private key of a certificate.
+type CertificatePrivateKey struct {
+	// Algorithm of the private key. Ed25519 keys are only accepted by some ACME servers.
+	//+kubebuilder:validation:Enum=RSA;ECDSA;Ed25519
+	//+kubebuilder:default=RSA
+	//+optional
+	Algorithm string `json:"algorithm,omitempty"`
+	// Size of the private key, 2048 (default), 3072 or 4096 bits for RSA and 256 (default) or 384 bits
+	// for ECDSA. It's ignored for Ed25519.
+	//+kubebuilder:validation:Enum=256;384;2048;3072;4096
+	//+optional
+	Size int `json:"size,omitempty"`
+	// RotationPolicy defines whether the private key is reused (Never) or regenerated (Always)
+	// when the certificate is renewed.
+	//+kubebuilder:validation:Enum=Never;Always
+	//+kubebuilder:default=Never
+	//+optional
+	RotationPolicy string `json:"rotationPolicy,omitempty"`
+}
+
+// CertificateSigningRequest references the PEM encoded certificate signing request of a certificate,
+// either Request or SecretRef must be set. Its DNS names must match the domains of the certificate.
+type CertificateSigningRequest struct {
+	// Request is the PEM encoded certificate signing request.
+	//+optional
+	Request []byte `json:"request,omitempty"`
+	// SecretRef references the request in a secret of the namespace of the certificate.
+	// The key defaults to tls.csr.
+	//+optional
+	SecretRef *SecretKeySelector `json:"secretRef,omitempty"`
+}
+
+// CertificateKeystores configures the keystores which are added to the secret.
+type CertificateKeystores struct {
+	// PKCS12 adds the certificate chain and the private key as keystore.p12, the CA bundle as truststore.p12.
+	//+optional
+	PKCS12 *CertificateKeystore `json:"pkcs12,omitempty"`
+	// JKS adds the certificate chain and the private key as keystore.jks, the CA bundle as truststore.jks.
+	//+optional
+	JKS *CertificateKeystore `json:"jks,omitempty"`
+}
+
+// CertificateKeystore configures a keystore.
+type CertificateKeystore struct {
+	// PasswordSecretRef references the password of the keystore in a secret of the namespace of the certificate.
+	// The key defaults to password.
+	PasswordSecretRef SecretKeySelector `json:"passwordSecretRef"`
+}
+
+// Output formats which can be added to the secret of a certificate.
+const (
+	// OutputFormatCombinedPEM adds the private key followed by the certificate chain as tls-combined.pem.
+	OutputFormatCombinedPEM = "CombinedPEM"
+	// OutputFormatDER adds the DER encoded certificate as tls.der and the PKCS#8 private key as key.der.
+	OutputFormatDER = "DER"
+)
+
+// CertificateOutputFormat is an additional encoding of the certificate.
+type CertificateOutputFormat struct {
+	// Type of the output format.
+	//+kubebuilder:validation:Enum=CombinedPEM;DER
+	Type string `json:"type"`
+}
+
+// CertificateStatus defines the observed state of Certificate
+type CertificateStatus struct {
+	// Conditions represent the latest available observations of the certificate's state.
+	//+optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// NotBefore is the time from which the current certificate is valid.
+	//+optional
+	NotBefore *metav1.Time `json:"notBefore,omitempty"`
+	// NotAfter is the expiration time of the current certificate.
+	//+optional
+	NotAfter *metav1.Time `json:"notAfter,omitempty"`
+	// SerialNumber is the hex encoded serial number of the current certificate.
+	//+optional
+	SerialNumber string `json:"serialNumber,omitempty"`
+	// RenewalTime is the time at which the current certificate is renewed.
+	//+optional
+	RenewalTime *metav1.Time `json:"renewalTime,omitempty"`
+	// LastFailureTime is the time of the last failed issuance or renewal.
+	//+optional
+	LastFailureTime *metav1.Time `json:"lastFailureTime,omitempty"`
+	// LastFailureMessage is the error of the last failed issuance or renewal.
+	//+optional
+	LastFailureMessage string `json:"lastFailureMessage,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:shortName=crt
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Secret",type=string,JSONPath=`.spec.secretName`
+//+kubebuilder:printcolumn:name="Expires",type=date,JSONPath=`.status.notAfter`
+//+kubebuilder:printcolumn:name="Renewal",type=date,JSONPath=`.status.renewalTime`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// Certificate is the Schema for the certificates API
+type Certificate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CertificateSpec   `json:"spec,omitempty"`
+	Status CertificateStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CertificateList contains a list of Certificate
+type CertificateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Certificate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Certificate{}, &CertificateList{})
+}
@@ -0,0 +1,406 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Kinds of issuers a certificate can reference.
+const (
+	IssuerKind        = "Issuer"
+	ClusterIssuerKind = "ClusterIssuer"
+)
+
+const (
+	// IssuerConditionReady indicates that the ACME account of the issuer is registered.
+	IssuerConditionReady = "Ready"
+)
+
+// Reasons of the issuer Ready condition.
+const (
+	IssuerReasonRegistered = "AccountRegistered"
+	IssuerReasonFailed     = "Failed"
+)
+
+// IssuerSpec defines the desired state of Issuer and ClusterIssuer
+type IssuerSpec struct {
+	// ACME configures the ACME server certificates are obtained from.
+	ACME *ACMEIssuer `json:"acme"`
+}
+
+// ACMEIssuer configures an ACME server and the account used for it.
+type ACMEIssuer struct {
+	// Server is the URL of the ACME directory.
+	Server string `json:"server"`
+	// Email is the contact email of the ACME account.
+	//+optional
+	Email string `json:"email,omitempty"`
+	// TermsOfServiceAgreed has to be true to register the account with the ACME server.
+	//+optional
+	TermsOfServiceAgreed bool `json:"termsOfServiceAgreed,omitempty"`
+	// ExternalAccountBinding binds the account to an account of the CA when it's registered,
+	// it's required by some commercial and internal ACME servers.
+	//+optional
+	ExternalAccountBinding *ACMEExternalAccountBinding `json:"externalAccountBinding,omitempty"`
+	// CABundle is a PEM encoded bundle of CA certificates which is used to verify the ACME server.
+	//+optional
+	CABundle []byte `json:"caBundle,omitempty"`
+	// PrivateKeySecretRef references the secret which stores the private key of the ACME account.
+	// The secret is created if it doesn't exist.
+	PrivateKeySecretRef SecretKeySelector `json:"privateKeySecretRef"`
+	// CA stores the chain of the issuing CA as ca.crt in the secrets of the certificates,
+	// so clients of the workloads can verify them.
+	//+optional
+	CA *ACMECABundle `json:"ca,omitempty"`
+	// DisableRenewalInfo ignores the renewal windows suggested by the ACME server (ACME Renewal Information),
+	// certificates are renewed according to their renewBefore configuration only.
+	//+optional
+	DisableRenewalInfo bool `json:"disableRenewalInfo,omitempty"`
+	// Solver configures how challenges are solved.
+	// HTTP-01 challenges are solved by a resolver pod behind the certificate's service if it's not set.
+	//+optional
+	Solver *ACMESolver `json:"solver,omitempty"`
+}
+
+// ACMEExternalAccountBinding references the external account binding credentials issued by the CA.
+type ACMEExternalAccountBinding struct {
+	// SecretName is the name of the secret which stores the key ID as keyID and the base64url encoded
+	// HMAC key as hmacKey. It's read from the namespace of the issuer, the cluster resource namespace
+	// for cluster issuers.
+	SecretName string `json:"secretName"`
+}
+
+// ACMECABundle configures the CA bundle which is stored with the certificates.
+type ACMECABundle struct {
+	// Roots is a PEM encoded bundle of root certificates which is appended to the chain of the issuer,
+	// ACME servers don't serve the root certificate of the chain.
+	//+optional
+	Roots []byte `json:"roots,omitempty"`
+}
+
+// ACMESolver configures the challenge type used to prove the control of the domains.
+// At most one challenge type can be set.
+type ACMESolver struct {
+	// HTTP01 configures the HTTP-01 challenge, which is used if no other challenge type is set.
+	//+optional
+	HTTP01 *ACMEHTTP01Solver `json:"http01,omitempty"`
+	// DNS01 solves DNS-01 challenges, it's required for wildcard domains.
+	//+optional
+	DNS01 *ACMEDNS01Solver `json:"dns01,omitempty"`
+	// TLSALPN01 solves TLS-ALPN-01 challenges by a resolver pod behind port 443 of the certificate's service.
+	//+optional
+	TLSALPN01 *ACMETLSALPN01Solver `json:"tlsALPN01,omitempty"`
+	// PodTemplate is merged into the resolver pods of HTTP-01 and TLS-ALPN-01 challenges.
+	//+optional
+	PodTemplate *ACMESolverPodTemplate `json:"podTemplate,omitempty"`
+}
+
+// ACMESolverPodTemplate configures the resolver pods.
+type ACMESolverPodTemplate struct {
+	// Metadata adds labels and annotations to the resolver pods.
+	//+optional
+	Metadata *ACMESolverPodObjectMeta `json:"metadata,omitempty"`
+	// Spec overrides fields of the resolver pods.
+	//+optional
+	Spec *ACMESolverPodSpec `json:"spec,omitempty"`
+}
+
+// ACMESolverPodObjectMeta are labels and annotations of the resolver pods.
+type ACMESolverPodObjectMeta struct {
+	//+optional
+	Labels map[string]string `json:"labels,omitempty"`
+	//+optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ACMESolverPodSpec are the fields of the resolver pods which can be overridden.
+type ACMESolverPodSpec struct {
+	// Image of the resolver, it defaults to the RESOLVER_CUSTOM_IMAGE environment variable of the controller.
+	//+optional
+	Image string `json:"image,omitempty"`
+	//+optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+	//+optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	//+optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	//+optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	//+optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	//+optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+	//+optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// SecurityContext of the pod. The sysctl which allows the resolver to listen on ports below 1024
+	// is added if the resolver needs it.
+	//+optional
+	SecurityContext *corev1.PodSecurityContext `json:"securityContext,omitempty"`
+	// ContainerSecurityContext replaces the security context of the resolver container, which drops
+	// all capabilities and privilege escalation by default.
+	//+optional
+	ContainerSecurityContext *corev1.SecurityContext `json:"containerSecurityContext,omitempty"`
+}
+
+// Self-checks of the HTTP-01 challenge.
+const (
+	SelfCheckService = "Service"
+	SelfCheckPublic  = "Public"
+	SelfCheckNone    = "None"
+)
+
+// Modes of routing the HTTP-01 challenge to the resolver pod.
+const (
+	SolverModeSelector      = "Selector"
+	SolverModeEndpointSlice = "EndpointSlice"
+	SolverModeIngress       = "Ingress"
+	SolverModeHTTPRoute     = "HTTPRoute"
+)
+
+// ACMEHTTP01Solver configures the HTTP-01 challenge.
+type ACMEHTTP01Solver struct {
+	// Mode routes the challenge to the resolver pod. Selector switches the selector of the service to the pod,
+	// which takes the application offline while the challenge is solved. EndpointSlice only routes port 80 of
+	// the service to the pod with a separate EndpointSlice, the other ports keep serving the application.
+	// Ingress and HTTPRoute leave the service untouched and route the challenge path of the domain to the pod
+	// with a temporary Ingress or Gateway API HTTPRoute.
+	//+kubebuilder:validation:Enum=Selector;EndpointSlice;Ingress;HTTPRoute
+	//+kubebuilder:default=Selector
+	//+optional
+	Mode string `json:"mode,omitempty"`
+	// Ingress configures the temporary Ingress of the Ingress mode.
+	//+optional
+	Ingress *ACMEHTTP01Ingress `json:"ingress,omitempty"`
+	// HTTPRoute configures the temporary HTTPRoute of the HTTPRoute mode.
+	//+optional
+	HTTPRoute *ACMEHTTP01HTTPRoute `json:"httpRoute,omitempty"`
+	// SelfCheck verifies that the token is served before the ACME server is asked to validate it.
+	// Service requests the token through the service, Public additionally through the domain and None
+	// disables the self-check.
+	//+kubebuilder:validation:Enum=Service;Public;None
+	//+kubebuilder:default=Service
+	//+optional
+	SelfCheck string `json:"selfCheck,omitempty"`
+}
+
+// ACMEHTTP01Ingress configures the Ingress which routes the challenge to the resolver.
+type ACMEHTTP01Ingress struct {
+	// IngressClassName of the Ingress, the default class of the cluster is used if it's not set.
+	//+optional
+	IngressClassName *string `json:"ingressClassName,omitempty"`
+	// Annotations of the Ingress, e.g. to configure the ingress controller.
+	//+optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ACMEHTTP01HTTPRoute configures the HTTPRoute which routes the challenge to the resolver.
+type ACMEHTTP01HTTPRoute struct {
+	// ParentRefs are the gateways the HTTPRoute is attached to.
+	//+kubebuilder:validation:MinItems=1
+	ParentRefs []GatewayParentReference `json:"parentRefs"`
+	// Labels of the HTTPRoute, e.g. to be selected by the gateways.
+	//+optional
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// GatewayParentReference references a Gateway of the Gateway API.
+type GatewayParentReference struct {
+	// Name of the Gateway.
+	Name string `json:"name"`
+	// Namespace of the Gateway, defaults to the namespace of the HTTPRoute.
+	//+optional
+	Namespace *string `json:"namespace,omitempty"`
+	// SectionName is the listener of the Gateway.
+	//+optional
+	SectionName *string `json:"sectionName,omitempty"`
+	// Port is the port of the listener of the Gateway.
+	//+optional
+	Port *int32 `json:"port,omitempty"`
+}
+
+// ACMETLSALPN01Solver configures the TLS-ALPN-01 challenge.
+type ACMETLSALPN01Solver struct {
+	// Port of the service the challenge is answered on, defaults to 443.
+	// Only the ACME server of a test environment is able to validate another port.
+	//+kubebuilder:default=443
+	//+optional
+	Port int32 `json:"port,omitempty"`
+}
+
+// ACMEDNS01Solver configures the DNS provider which publishes the DNS-01 challenge records.
+// Exactly one provider has to be set.
+type ACMEDNS01Solver struct {
+	// RFC2136 updates the records with dynamic DNS updates.
+	//+optional
+	RFC2136 *ACMEDNS01RFC2136 `json:"rfc2136,omitempty"`
+	// Webhook delegates the records to an HTTP endpoint.
+	//+optional
+	Webhook *ACMEDNS01Webhook `json:"webhook,omitempty"`
+	// RecursiveNameservers are used to check the propagation of the records, in the form "host:port".
+	// The nameservers of the system are used if it's not set.
+	//+optional
+	RecursiveNameservers []string `json:"recursiveNameservers,omitempty"`
+	// PropagationTimeout is how long to wait for the records to propagate, defaults to 60s.
+	//+optional
+	PropagationTimeout *metav1.Duration `json:"propagationTimeout,omitempty"`
+}
+
+// ACMEDNS01RFC2136 configures dynamic DNS updates (RFC 2136) against an authoritative nameserver.
+type ACMEDNS01RFC2136 struct {
+	// Nameserver receiving the updates, in the form "host" or "host:port".
+	Nameserver string `json:"nameserver"`
+	// TSIGKeyName is the name of the TSIG key, updates are not signed if it's not set.
+	//+optional
+	TSIGKeyName string `json:"tsigKeyName,omitempty"`
+	// TSIGAlgorithm of the key, defaults to hmac-sha1.
+	//+optional
+	TSIGAlgorithm string `json:"tsigAlgorithm,omitempty"`
+	// TSIGSecretSecretRef references the base64 encoded TSIG secret, the key defaults to secret.
+	//+optional
+	TSIGSecretSecretRef *SecretKeySelector `json:"tsigSecretSecretRef,omitempty"`
+}
+
+// ACMEDNS01Webhook configures an HTTP endpoint which manages the records.
+// The endpoint receives POST requests on /present and /cleanup with a JSON body {"fqdn": "...", "value": "..."}.
+type ACMEDNS01Webhook struct {
+	// URL of the endpoint.
+	URL string `json:"url"`
+	// CABundle is a PEM encoded bundle of CA certificates which is used to verify the endpoint.
+	//+optional
+	CABundle []byte `json:"caBundle,omitempty"`
+	// CredentialsSecretRef references a secret with the username and password keys for basic authentication.
+	//+optional
+	CredentialsSecretRef *SecretReference `json:"credentialsSecretRef,omitempty"`
+}
+
+// SecretReference references a secret in the namespace of the issuer.
+// Secrets of a ClusterIssuer are read from the cluster resource namespace.
+type SecretReference struct {
+	// Name of the secret.
+	Name string `json:"name"`
+}
+
+// SecretKeySelector selects a key of a secret in the namespace of the issuer.
+// Secrets of a ClusterIssuer are read from the cluster resource namespace.
+type SecretKeySelector struct {
+	// Name of the secret.
+	Name string `json:"name"`
+	// Key of the secret, defaults to the key specific to the referencing field.
+	//+optional
+	Key string `json:"key,omitempty"`
+}
+
+// IssuerStatus defines the observed state of Issuer and ClusterIssuer
+type IssuerStatus struct {
+	// Conditions represent the latest available observations of the issuer's state.
+	//+optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// ACME is the state of the ACME account.
+	//+optional
+	ACME *ACMEIssuerStatus `json:"acme,omitempty"`
+}
+
+// ACMEIssuerStatus is the state of the ACME account.
+type ACMEIssuerStatus struct {
+	// URI of the registered ACME account.
+	//+optional
+	URI string `json:"uri,omitempty"`
+	// LastRegisteredEmail is the email the account was registered with.
+	//+optional
+	LastRegisteredEmail string `json:"lastRegisteredEmail,omitempty"`
+	// Server is the URL of the ACME directory the account is registered with.
+	//+optional
+	Server string `json:"server,omitempty"`
+	// KeyThumbprint is the hex encoded SHA-256 hash of the public key of the account.
+	//+optional
+	KeyThumbprint string `json:"keyThumbprint,omitempty"`
+}
+
+// GenericIssuer is implemented by Issuer and ClusterIssuer.
+// +kubebuilder:object:generate=false
+type GenericIssuer interface {
+	runtime.Object
+	metav1.Object
+
+	GetSpec() *IssuerSpec
+	GetStatus() *IssuerStatus
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Server",type=string,JSONPath=`.spec.acme.server`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// Issuer is the Schema for the issuers API
+type Issuer struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   IssuerSpec   `json:"spec,omitempty"`
+	Status IssuerStatus `json:"status,omitempty"`
+}
+
+// GetSpec returns the spec of the issuer.
+func (i *Issuer) GetSpec() *IssuerSpec { return &i.Spec }
+
+// GetStatus returns the status of the issuer.
+func (i *Issuer) GetStatus() *IssuerStatus { return &i.Status }
+
+//+kubebuilder:object:root=true
+
+// IssuerList contains a list of Issuer
+type IssuerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Issuer `json:"items"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Server",type=string,JSONPath=`.spec.acme.server`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ClusterIssuer is the Schema for the clusterissuers API
+type ClusterIssuer struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   IssuerSpec   `json:"spec,omitempty"`
+	Status IssuerStatus `json:"status,omitempty"`
+}
+
+// GetSpec returns the spec of the cluster issuer.
+func (i *ClusterIssuer) GetSpec() *IssuerSpec { return &i.Spec }
+
+// GetStatus returns the status of the cluster issuer.
+func (i *ClusterIssuer) GetStatus() *IssuerStatus { return &i.Status }
+
+//+kubebuilder:object:root=true
+
+// ClusterIssuerList contains a list of ClusterIssuer
+type ClusterIssuerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterIssuer `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Issuer{}, &IssuerList{}, &ClusterIssuer{}, &ClusterIssuerList{})
+}
@@ -0,0 +1,109 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/onmetal/injector/internal/logger"
+)
+
+const (
+	// APITokenEnv is the bearer token of the challenge api, the api is disabled without it.
+	APITokenEnv = "API_TOKEN"
+	// APIPortEnv is the port of the challenge api, 8089 by default.
+	APIPortEnv = "API_PORT"
+	// ChallengesPath adds challenges with PUT and removes them with DELETE requests.
+	// The body is a Challenge, the response reports the number of challenges of the resolver.
+	ChallengesPath = "/challenges"
+)
+
+// ChallengesResponse is the response of the challenge api.
+type ChallengesResponse struct {
+	Challenges int `json:"challenges"`
+}
+
+// api updates the challenges of the resolver.
+type api struct {
+	log        logger.Logger
+	port       string
+	token      string
+	challenges *challenges
+}
+
+func newAPI(l logger.Logger, port, token string, c *challenges) *api {
+	if token == "" {
+		l.Info("api token not provided, challenge api is disabled")
+		return nil
+	}
+	return &api{log: l, port: port, token: token, challenges: c}
+}
+
+func (a *api) router() *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(middleware.Recoverer)
+	r.Use(a.authenticate)
+	r.Put(ChallengesPath, a.update(a.challenges.add))
+	r.Delete(ChallengesPath, a.update(a.challenges.remove))
+	return r
+}
+
+func (a *api) Run() error {
+	a.log.Info("challenge api started", "port", a.port)
+	return http.ListenAndServe(a.port, a.router())
+}
+
+func (a *api) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			a.log.Info("unauthorized api request", "remote", r.RemoteAddr)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *api) update(apply func(Challenge) int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var ch Challenge
+		if err := json.NewDecoder(r.Body).Decode(&ch); err != nil || ch.Domain == "" {
+			http.Error(w, "invalid challenge", http.StatusBadRequest)
+			return
+		}
+		n := apply(ch)
+		a.log.Info("challenges updated", "method", r.Method, "domain", ch.Domain, "token", ch.Token)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(ChallengesResponse{Challenges: n}); err != nil {
+			a.log.Error("can't write response", err)
+		}
+	}
+}
+
+// serve runs the server and the challenge api until one of them fails.
+func serve(a *api, run func() error) error {
+	if a == nil {
+		return run()
+	}
+	errs := make(chan error, 2)
+	go func() { errs <- a.Run() }()
+	go func() { errs <- run() }()
+	return <-errs
+}
@@ -0,0 +1,88 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"os"
+	"sync"
+
+	"github.com/onmetal/injector/internal/logger"
+)
+
+// Challenge is a challenge the resolver answers.
+type Challenge struct {
+	Domain           string `json:"domain"`
+	Token            string `json:"token"`
+	KeyAuthorization string `json:"keyAuthorization"`
+}
+
+type challengeKey struct {
+	domain, token string
+}
+
+// challenges is the table of the challenges the resolver answers.
+type challenges struct {
+	mu      sync.RWMutex
+	entries map[challengeKey]string
+}
+
+func newChallenges() *challenges {
+	return &challenges{entries: map[challengeKey]string{}}
+}
+
+// seed adds the challenge configured by the DOMAIN_NAME, TOKEN and AUTH_KEY environment variables.
+func (c *challenges) seed(l logger.Logger) {
+	domain, authKey := os.Getenv("DOMAIN_NAME"), os.Getenv("AUTH_KEY")
+	if domain == "" || authKey == "" {
+		l.Info("no challenge provided by environment, waiting for challenges of the api")
+		return
+	}
+	c.add(Challenge{Domain: domain, Token: os.Getenv("TOKEN"), KeyAuthorization: authKey})
+}
+
+// add adds the challenge and returns the number of challenges.
+func (c *challenges) add(ch Challenge) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[challengeKey{ch.Domain, ch.Token}] = ch.KeyAuthorization
+	return len(c.entries)
+}
+
+// remove removes the challenge and returns the number of remaining challenges.
+func (c *challenges) remove(ch Challenge) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, challengeKey{ch.Domain, ch.Token})
+	return len(c.entries)
+}
+
+// keyAuthorization returns the key authorization of the http-01 challenge.
+func (c *challenges) keyAuthorization(domain, token string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	key, ok := c.entries[challengeKey{domain, token}]
+	return key, ok
+}
+
+// domainKeyAuthorization returns the key authorization of the tls-alpn-01 challenge, which has no token.
+func (c *challenges) domainKeyAuthorization(domain string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for k, key := range c.entries {
+		if k.domain == domain {
+			return key, true
+		}
+	}
+	return "", false
+}
@@ -16,7 +16,6 @@ package server
 import (
 	"fmt"
 	"net/http"
-	"os"
 	"path"
 	"strings"
 
@@ -31,52 +30,30 @@ const (
 )
 
 type httpChallenge struct {
-	domain, token, authKey string
-	log                    logger.Logger
+	challenges *challenges
+	log        logger.Logger
 }
 
-func newRouter(l logger.Logger) *chi.Mux {
+func newRouter(l logger.Logger, c *challenges) *chi.Mux {
 	router := chi.NewRouter()
 	router.Use(middleware.Recoverer)
 	router.Use(middleware.Logger)
-	newHandlers(router, l)
+	newHandlers(router, l, c)
 	return router
 }
 
-func newHandlers(r *chi.Mux, l logger.Logger) {
-	c := newHTTPChallenge(l)
-	p := fmt.Sprintf("%s/%s", HTTPChallengePath, c.token)
+func newHandlers(r *chi.Mux, l logger.Logger, c *challenges) {
+	h := &httpChallenge{challenges: c, log: l}
+	p := fmt.Sprintf("%s/{token}", HTTPChallengePath)
 	l.Info("listening on", "path", p)
-	r.Get(p, c.challenge)
-	r.Post(p, c.challenge)
-}
-
-func newHTTPChallenge(l logger.Logger) httpChallenge {
-	domain := os.Getenv("DOMAIN_NAME")
-	if domain == "" {
-		l.Info("domain not provided")
-	}
-	token := os.Getenv("TOKEN")
-	if token == "" {
-		l.Info("token not provided")
-	}
-	authKey := os.Getenv("AUTH_KEY")
-	if authKey == "" {
-		l.Info("auth key not provided")
-	}
-	return httpChallenge{
-		domain:  domain,
-		token:   token,
-		authKey: authKey,
-		log:     l,
-	}
+	r.Get(p, h.challenge)
+	r.Post(p, h.challenge)
 }
 
 func (h *httpChallenge) challenge(w http.ResponseWriter, r *http.Request) {
 	host := strings.Split(r.Host, ":")[0]
 	basePath := path.Dir(r.URL.EscapedPath())
 	token := path.Base(r.URL.EscapedPath())
-	key := h.authKey
 
 	log := h.log.WithValues(
 		"host", host,
@@ -92,17 +69,10 @@ func (h *httpChallenge) challenge(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Info("comparing host", "expected_host", h.domain)
-	if h.domain != host {
-		log.Info("invalid host", "expected_host", h.domain)
-		http.NotFound(w, r)
-		return
-	}
-
-	log.Info("comparing token", "expected_token", h.token)
-	if h.token != token {
+	key, ok := h.challenges.keyAuthorization(host, token)
+	if !ok {
 		// if nothing else, we return a 404 here
-		log.Info("invalid token", "expected_token", h.token)
+		log.Info("no challenge for host and token")
 		http.NotFound(w, r)
 		return
 	}
@@ -22,6 +22,15 @@ import (
 	"github.com/onmetal/injector/internal/logger"
 )
 
+const (
+	// ChallengeTypeEnv selects the challenge the resolver answers, http-01 by default.
+	ChallengeTypeEnv = "CHALLENGE_TYPE"
+	// ChallengeTypeHTTP01 answers http-01 requests on PORT, 8080 by default.
+	ChallengeTypeHTTP01 = "http-01"
+	// ChallengeTypeTLSALPN01 answers tls-alpn-01 handshakes on PORT, 443 by default.
+	ChallengeTypeTLSALPN01 = "tls-alpn-01"
+)
+
 type Server interface {
 	Run() error
 }
@@ -30,23 +39,43 @@ type server struct {
 	router *chi.Mux
 	log    logger.Logger
 	port   string
+	api    *api
 }
 
+// New returns the resolver of the challenge type. It answers the challenge of the DOMAIN_NAME, TOKEN and AUTH_KEY
+// environment variables and the challenges added by the challenge api.
 func New() Server {
-	port := ":8080"
-	if os.Getenv("PORT") != "" {
-		port = fmt.Sprintf(":%s", os.Getenv("PORT"))
-	}
 	l := logger.New()
-	r := newRouter(l)
+	c := newChallenges()
+	c.seed(l)
+	a := newAPI(l, envPort(APIPortEnv, "8089"), os.Getenv(APITokenEnv), c)
+	if os.Getenv(ChallengeTypeEnv) == ChallengeTypeTLSALPN01 {
+		return newTLSALPNServer(l, listenPort("443"), c, a)
+	}
+	port := listenPort("8080")
+	r := newRouter(l, c)
 	return &server{
 		router: r,
 		log:    l,
 		port:   port,
+		api:    a,
 	}
 }
 
 func (s *server) Run() error {
-	s.log.Info("server started", "port", s.port)
-	return http.ListenAndServe(s.port, s.router)
+	return serve(s.api, func() error {
+		s.log.Info("server started", "port", s.port)
+		return http.ListenAndServe(s.port, s.router)
+	})
+}
+
+func listenPort(defaultPort string) string {
+	return envPort("PORT", defaultPort)
+}
+
+func envPort(env, defaultPort string) string {
+	if os.Getenv(env) != "" {
+		return fmt.Sprintf(":%s", os.Getenv(env))
+	}
+	return fmt.Sprintf(":%s", defaultPort)
 }
@@ -14,17 +14,26 @@ limitations under the License.
 package server
 
 import (
+	"bytes"
+	"crypto/tls"
+	"encoding/asn1"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/go-acme/lego/v4/challenge/tlsalpn01"
+	"github.com/onmetal/injector/internal/logger"
 	"github.com/stretchr/testify/assert"
 )
 
+var idPeAcmeIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
 var envs = map[string]string{
 	"PORT":        "8080",
 	"DOMAIN_NAME": "domain.com",
@@ -94,6 +103,105 @@ func TestHandler(t *testing.T) {
 	a.Equal(http.StatusOK, resp.StatusCode, "expected 200")
 }
 
+func TestTLSALPNHandshake(t *testing.T) {
+	a := assert.New(t)
+	c := newChallenges()
+	c.add(Challenge{Domain: "domain.com", KeyAuthorization: "123456"})
+	s := newTLSALPNServer(logger.New(), ":0", c, nil).(*tlsALPNServer)
+	listener, err := s.listener()
+	if !a.NoError(err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() { _ = s.accept(listener) }()
+	addr := listener.Addr().String()
+
+	config := &tls.Config{
+		ServerName:         "domain.com",
+		NextProtos:         []string{tlsalpn01.ACMETLS1Protocol},
+		InsecureSkipVerify: true, // the challenge certificate is self-signed
+	}
+	conn, err := tls.Dial("tcp", addr, config)
+	if !a.NoError(err) {
+		t.FailNow()
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	a.Equal(tlsalpn01.ACMETLS1Protocol, state.NegotiatedProtocol)
+	a.Equal([]string{"domain.com"}, state.PeerCertificates[0].DNSNames)
+	var found bool
+	for _, ext := range state.PeerCertificates[0].Extensions {
+		found = found || ext.Id.Equal(idPeAcmeIdentifier)
+	}
+	a.True(found, "acmeIdentifier extension is missing")
+
+	config.ServerName = "other.com"
+	_, err = tls.Dial("tcp", addr, config)
+	a.Error(err)
+}
+
+func TestChallengeAPI(t *testing.T) {
+	a := assert.New(t)
+	l := logger.New()
+	c := newChallenges()
+	api := httptest.NewServer(newAPI(l, ":0", "secret", c).router())
+	defer api.Close()
+	resolver := httptest.NewServer(newRouter(l, c))
+	defer resolver.Close()
+
+	update := func(method, token string, ch Challenge) (int, ChallengesResponse) {
+		body, err := json.Marshal(ch)
+		a.NoError(err)
+		req, err := http.NewRequest(method, api.URL+ChallengesPath, bytes.NewReader(body))
+		a.NoError(err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if !a.NoError(err) {
+			t.FailNow()
+		}
+		defer resp.Body.Close()
+		var r ChallengesResponse
+		_ = json.NewDecoder(resp.Body).Decode(&r)
+		return resp.StatusCode, r
+	}
+	get := func(host, token string) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, resolver.URL+HTTPChallengePath+"/"+token, nil)
+		a.NoError(err)
+		req.Host = host
+		resp, err := http.DefaultClient.Do(req)
+		if !a.NoError(err) {
+			t.FailNow()
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	status, _ := update(http.MethodPut, "wrong", Challenge{Domain: "a.com", Token: "t1", KeyAuthorization: "k1"})
+	a.Equal(http.StatusUnauthorized, status)
+
+	status, r := update(http.MethodPut, "secret", Challenge{Domain: "a.com", Token: "t1", KeyAuthorization: "k1"})
+	a.Equal(http.StatusOK, status)
+	a.Equal(1, r.Challenges)
+	_, r = update(http.MethodPut, "secret", Challenge{Domain: "b.com", Token: "t2", KeyAuthorization: "k2"})
+	a.Equal(2, r.Challenges)
+
+	status, body := get("a.com", "t1")
+	a.Equal(http.StatusOK, status)
+	a.Equal("k1", body)
+	status, _ = get("a.com", "t2")
+	a.Equal(http.StatusNotFound, status)
+
+	_, r = update(http.MethodDelete, "secret", Challenge{Domain: "a.com", Token: "t1"})
+	a.Equal(1, r.Challenges)
+	status, _ = get("a.com", "t1")
+	a.Equal(http.StatusNotFound, status)
+	status, body = get("b.com", "t2")
+	a.Equal(http.StatusOK, status)
+	a.Equal("k2", body)
+}
+
 func setupEnvs() error {
 	for name, value := range envs {
 		if err := os.Setenv(name, value); err != nil {
@@ -102,3 +210,30 @@ func setupEnvs() error {
 	}
 	return nil
 }
+
+func TestTLSALPNCertificateCache(t *testing.T) {
+	a := assert.New(t)
+	c := newChallenges()
+	s := newTLSALPNServer(logger.New(), ":0", c, nil).(*tlsALPNServer)
+	hello := func(domain string) *tls.ClientHelloInfo {
+		return &tls.ClientHelloInfo{ServerName: domain, SupportedProtos: []string{tlsalpn01.ACMETLS1Protocol}}
+	}
+	c.add(Challenge{Domain: "domain.com", KeyAuthorization: "123456"})
+	c.add(Challenge{Domain: "other.com", KeyAuthorization: "abcdef"})
+	cert, err := s.certificate(hello("domain.com"))
+	a.NoError(err)
+	cached, err := s.certificate(hello("domain.com"))
+	a.NoError(err)
+	a.Same(cert, cached)
+	_, err = s.certificate(hello("other.com"))
+	a.NoError(err)
+	a.Len(s.certs, 2)
+
+	c.remove(Challenge{Domain: "domain.com"})
+	c.add(Challenge{Domain: "other.com", KeyAuthorization: "ghijkl"})
+	renewed, err := s.certificate(hello("other.com"))
+	a.NoError(err)
+	a.Equal("ghijkl", s.certs["other.com"].keyAuthorization, "a new key authorization replaces the certificate")
+	a.NotNil(renewed)
+	a.Len(s.certs, 1, "certificates of removed challenges are dropped")
+}
@@ -0,0 +1,144 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-acme/lego/v4/challenge/tlsalpn01"
+	"github.com/onmetal/injector/internal/logger"
+)
+
+const handshakeTimeout = 10 * time.Second
+
+// tlsALPNServer answers tls-alpn-01 challenge handshakes with the acmeIdentifier certificate.
+type tlsALPNServer struct {
+	log        logger.Logger
+	port       string
+	challenges *challenges
+	api        *api
+
+	mu sync.Mutex
+	// certs caches the challenge certificates by domain, entries are dropped once their challenge is removed
+	certs map[string]challengeCert
+}
+
+// challengeCert is the challenge certificate for a key authorization.
+type challengeCert struct {
+	keyAuthorization string
+	cert             *tls.Certificate
+}
+
+func newTLSALPNServer(l logger.Logger, port string, c *challenges, a *api) Server {
+	return &tlsALPNServer{
+		log:        l,
+		port:       port,
+		challenges: c,
+		api:        a,
+		certs:      map[string]challengeCert{},
+	}
+}
+
+func (s *tlsALPNServer) Run() error {
+	return serve(s.api, s.listen)
+}
+
+func (s *tlsALPNServer) listen() error {
+	listener, err := s.listener()
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	s.log.Info("server started", "port", s.port, "protocol", tlsalpn01.ACMETLS1Protocol)
+	return s.accept(listener)
+}
+
+// listener returns the TLS listener on the port of the server.
+func (s *tlsALPNServer) listener() (net.Listener, error) {
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{tlsalpn01.ACMETLS1Protocol},
+		GetCertificate: s.certificate,
+	}
+	return tls.Listen("tcp", s.port, config)
+}
+
+// accept answers the handshakes of the connections of the listener until it's closed.
+func (s *tlsALPNServer) accept(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handshake(conn)
+	}
+}
+
+func (s *tlsALPNServer) certificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if !supportsACMETLS1(hello.SupportedProtos) {
+		return nil, fmt.Errorf("protocol %s is not supported by the client", tlsalpn01.ACMETLS1Protocol)
+	}
+	authKey, ok := s.challenges.domainKeyAuthorization(hello.ServerName)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// drop the certificates of removed challenges
+	for domain := range s.certs {
+		if _, ok := s.challenges.domainKeyAuthorization(domain); !ok {
+			delete(s.certs, domain)
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("no challenge for server name %s", hello.ServerName)
+	}
+	if c, ok := s.certs[hello.ServerName]; ok && c.keyAuthorization == authKey {
+		return c.cert, nil
+	}
+	cert, err := tlsalpn01.ChallengeCert(hello.ServerName, authKey)
+	if err != nil {
+		return nil, err
+	}
+	s.certs[hello.ServerName] = challengeCert{keyAuthorization: authKey, cert: cert}
+	return cert, nil
+}
+
+func (s *tlsALPNServer) handshake(conn net.Conn) {
+	defer conn.Close()
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return
+	}
+	log := s.log.WithValues("remote", conn.RemoteAddr().String())
+	if err := tlsConn.SetDeadline(time.Now().Add(handshakeTimeout)); err != nil {
+		log.Error("can't set deadline", err)
+		return
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		log.Info("invalid challenge handshake", "error", err.Error())
+		return
+	}
+	log.Info("got successful challenge handshake", "server_name", tlsConn.ConnectionState().ServerName)
+}
+
+func supportsACMETLS1(protos []string) bool {
+	for _, p := range protos {
+		if p == tlsalpn01.ACMETLS1Protocol {
+			return true
+		}
+	}
+	return false
+}
@@ -17,9 +17,11 @@ import (
 	"flag"
 	"os"
 
-	"github.com/onmetal/injector/controllers/renew"
-
+	"github.com/onmetal/injector/api/v1alpha1"
+	"github.com/onmetal/injector/controllers/certificate"
 	"github.com/onmetal/injector/controllers/issuer"
+	"github.com/onmetal/injector/controllers/service"
+	"github.com/onmetal/injector/internal/issuer/solver"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -41,6 +43,7 @@ var (
 
 func main() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(v1alpha1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 
 	var metricsAddr, probeAddr string
@@ -71,6 +74,13 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err = (&certificate.Reconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Certificate")
+		os.Exit(1)
+	}
 	if err = (&issuer.Reconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
@@ -78,15 +88,27 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "Issuer")
 		os.Exit(1)
 	}
-	if err = (&renew.Reconciler{
+	if err = (&issuer.ClusterReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterIssuer")
+		os.Exit(1)
+	}
+	if err = (&service.Reconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Renew")
+		setupLog.Error(err, "unable to create controller", "controller", "Service")
 		os.Exit(1)
 	}
 	//+kubebuilder:scaffold:builder
 
+	if err := mgr.Add(&solver.Sweeper{Client: mgr.GetClient()}); err != nil {
+		setupLog.Error(err, "unable to set up acme resolver sweeper")
+		os.Exit(1)
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -0,0 +1,130 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package patch
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Diff returns the minimal operations which turn the original into the mutated object, both are located at
+// the JSON pointer path of the patched document.
+// Missing fields are added with their parents, appended array items are added with "/-". Values which are
+// replaced or removed and the names of array items which are changed are guarded by test operations,
+// so the patch fails instead of changing the wrong item if the document differs from the original.
+func Diff(path string, original, mutated interface{}) ([]Operation, error) {
+	o, err := toJSON(original)
+	if err != nil {
+		return nil, err
+	}
+	m, err := toJSON(mutated)
+	if err != nil {
+		return nil, err
+	}
+	return diff(path, o, m, nil), nil
+}
+
+func toJSON(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	return out, json.Unmarshal(b, &out)
+}
+
+func diff(path string, original, mutated interface{}, ops []Operation) []Operation {
+	if reflect.DeepEqual(original, mutated) {
+		return ops
+	}
+	switch m := mutated.(type) {
+	case map[string]interface{}:
+		if o, ok := original.(map[string]interface{}); ok {
+			return diffObject(path, o, m, ops)
+		}
+	case []interface{}:
+		if o, ok := original.([]interface{}); ok {
+			return diffArray(path, o, m, ops)
+		}
+	}
+	if original == nil {
+		return append(ops, AddPatchOperation(path, mutated))
+	}
+	return append(ops, TestPatchOperation(path, original), ReplacePatchOperation(path, mutated))
+}
+
+func diffObject(path string, original, mutated map[string]interface{}, ops []Operation) []Operation {
+	for _, k := range sortedKeys(original) {
+		if _, ok := mutated[k]; !ok {
+			p := path + "/" + escape(k)
+			ops = append(ops, TestPatchOperation(p, original[k]), RemovePatchOperation(p))
+		}
+	}
+	for _, k := range sortedKeys(mutated) {
+		p := path + "/" + escape(k)
+		if o, ok := original[k]; ok {
+			ops = diff(p, o, mutated[k], ops)
+		} else {
+			ops = append(ops, AddPatchOperation(p, mutated[k]))
+		}
+	}
+	return ops
+}
+
+func diffArray(path string, original, mutated []interface{}, ops []Operation) []Operation {
+	if len(mutated) < len(original) {
+		return append(ops, TestPatchOperation(path, original), ReplacePatchOperation(path, mutated))
+	}
+	for i := range original {
+		if reflect.DeepEqual(original[i], mutated[i]) {
+			continue
+		}
+		p := path + "/" + strconv.Itoa(i)
+		// items with a name, e.g. containers, are identified by it
+		if name, ok := itemName(original[i]); ok {
+			ops = append(ops, TestPatchOperation(p+"/name", name))
+		}
+		ops = diff(p, original[i], mutated[i], ops)
+	}
+	for _, item := range mutated[len(original):] {
+		ops = append(ops, AddPatchOperation(path+"/-", item))
+	}
+	return ops
+}
+
+func itemName(item interface{}) (interface{}, bool) {
+	obj, ok := item.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	name, ok := obj["name"]
+	return name, ok
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escape escapes a key as a reference token of a JSON pointer https://tools.ietf.org/html/rfc6901.
+func escape(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
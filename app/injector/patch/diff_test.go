@@ -0,0 +1,119 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package patch
+
+import (
+	"encoding/json"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func apply(t *testing.T, doc interface{}, ops []Operation) ([]byte, error) {
+	t.Helper()
+	d, err := json.Marshal(doc)
+	assert.NoError(t, err)
+	b, err := json.Marshal(ops)
+	assert.NoError(t, err)
+	p, err := jsonpatch.DecodePatch(b)
+	assert.NoError(t, err)
+	return p.Apply(d)
+}
+
+func TestDiffPodSpec(t *testing.T) {
+	a := assert.New(t)
+	original := &corev1.PodSpec{Containers: []corev1.Container{
+		{Name: "app", VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: "/data"}}},
+		{Name: "proxy"},
+	}}
+	mutated := original.DeepCopy()
+	mutated.Containers[0].VolumeMounts = append(mutated.Containers[0].VolumeMounts,
+		corev1.VolumeMount{Name: "tls", MountPath: "/certs"})
+	mutated.Containers[1].VolumeMounts = []corev1.VolumeMount{{Name: "tls", MountPath: "/certs"}}
+	mutated.Volumes = []corev1.Volume{{Name: "tls"}}
+
+	ops, err := Diff("/spec", original, mutated)
+	a.NoError(err)
+	a.Equal([]Operation{
+		TestPatchOperation("/spec/containers/0/name", "app"),
+		AddPatchOperation("/spec/containers/0/volumeMounts/-", map[string]interface{}{"name": "tls", "mountPath": "/certs"}),
+		TestPatchOperation("/spec/containers/1/name", "proxy"),
+		AddPatchOperation("/spec/containers/1/volumeMounts",
+			[]interface{}{map[string]interface{}{"name": "tls", "mountPath": "/certs"}}),
+		AddPatchOperation("/spec/volumes", []interface{}{map[string]interface{}{"name": "tls"}}),
+	}, ops)
+
+	// a volume added by another webhook is kept
+	doc := &corev1.Pod{Spec: *original.DeepCopy()}
+	doc.Spec.Volumes = []corev1.Volume{{Name: "other"}}
+	doc.Spec.Containers[1].VolumeMounts = nil
+	out, err := apply(t, doc, ops)
+	a.NoError(err)
+	pod := &corev1.Pod{}
+	a.NoError(json.Unmarshal(out, pod))
+	a.Equal(mutated.Containers, pod.Spec.Containers)
+	a.Equal([]corev1.Volume{{Name: "tls"}}, pod.Spec.Volumes)
+
+	// the patch fails if the containers were reordered
+	doc = &corev1.Pod{Spec: *original.DeepCopy()}
+	doc.Spec.Containers[0], doc.Spec.Containers[1] = doc.Spec.Containers[1], doc.Spec.Containers[0]
+	_, err = apply(t, doc, ops)
+	a.Error(err)
+}
+
+func TestDiffAppend(t *testing.T) {
+	a := assert.New(t)
+	original := &corev1.PodSpec{Volumes: []corev1.Volume{{Name: "data"}}}
+	mutated := original.DeepCopy()
+	mutated.Volumes = append(mutated.Volumes, corev1.Volume{Name: "tls"})
+	ops, err := Diff("/spec/template/spec", original, mutated)
+	a.NoError(err)
+	a.Equal([]Operation{
+		AddPatchOperation("/spec/template/spec/volumes/-", map[string]interface{}{"name": "tls"}),
+	}, ops)
+}
+
+func TestDiffReplaceAndRemove(t *testing.T) {
+	a := assert.New(t)
+	original := map[string]interface{}{
+		"annotations": map[string]string{"cert.injector.ko/hash": "a", "removed": "b"},
+		"items":       []string{"a", "b"},
+	}
+	mutated := map[string]interface{}{
+		"annotations": map[string]string{"cert.injector.ko/hash": "c"},
+		"items":       []string{"b"},
+	}
+	ops, err := Diff("", original, mutated)
+	a.NoError(err)
+	a.Equal([]Operation{
+		TestPatchOperation("/annotations/removed", "b"),
+		RemovePatchOperation("/annotations/removed"),
+		TestPatchOperation("/annotations/cert.injector.ko~1hash", "a"),
+		ReplacePatchOperation("/annotations/cert.injector.ko~1hash", "c"),
+		TestPatchOperation("/items", []interface{}{"a", "b"}),
+		ReplacePatchOperation("/items", []interface{}{"b"}),
+	}, ops)
+
+	out, err := apply(t, original, ops)
+	a.NoError(err)
+	expected, err := json.Marshal(mutated)
+	a.NoError(err)
+	a.JSONEq(string(expected), string(out))
+
+	ops, err = Diff("", original, original)
+	a.NoError(err)
+	a.Empty(ops)
+}
@@ -19,13 +19,14 @@ const (
 	replaceOperation = "replace"
 	copyOperation    = "copy"
 	moveOperation    = "move"
+	testOperation    = "test"
 )
 
 // Operation is an operation of a JSON patch https://tools.ietf.org/html/rfc6902.
 type Operation struct {
 	Op    string      `json:"op"`
 	Path  string      `json:"path"`
-	From  string      `json:"from"`
+	From  string      `json:"from,omitempty"`
 	Value interface{} `json:"value,omitempty"`
 }
 
@@ -55,6 +56,15 @@ func ReplacePatchOperation(path string, value interface{}) Operation {
 	}
 }
 
+// TestPatchOperation returns a test JSON patch operation, the patch fails if the value differs.
+func TestPatchOperation(path string, value interface{}) Operation {
+	return Operation{
+		Op:    testOperation,
+		Path:  path,
+		Value: value,
+	}
+}
+
 // CopyPatchOperation returns a copy JSON patch operation.
 func CopyPatchOperation(from, path string) Operation {
 	return Operation{
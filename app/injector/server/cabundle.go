@@ -0,0 +1,95 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// AdmissionWebhookAnnotationCABundleKey is the name of a certificate secret whose CA bundle is mounted
+	// into all containers of the workload, the workload doesn't need the certificate itself.
+	AdmissionWebhookAnnotationCABundleKey = "cert.injector.ko/ca-bundle"
+	// AdmissionWebhookAnnotationCABundlePathKey is the absolute directory the CA bundle is mounted at.
+	AdmissionWebhookAnnotationCABundlePathKey = "cert.injector.ko/ca-bundle-path"
+	// AdmissionWebhookAnnotationCABundleEnvKey exposes the path of the CA bundle as SSL_CERT_FILE
+	// environment variable if it's "true".
+	AdmissionWebhookAnnotationCABundleEnvKey = "cert.injector.ko/ca-bundle-env"
+	// CABundleKey is the key of the CA bundle in the certificate secret.
+	CABundleKey = "ca.crt"
+)
+
+const (
+	caVolumeName        = "ca-bundle"
+	defaultCABundlePath = "/ca-certs"
+	caBundleEnv         = "SSL_CERT_FILE"
+)
+
+func isCABundleRequired(a map[string]string) bool {
+	_, ok := a[AdmissionWebhookAnnotationCABundleKey]
+	return ok
+}
+
+// mountCABundle mounts the CA bundle of the certificate secret into all containers of the pod spec,
+// a previous mount is replaced.
+func mountCABundle(spec *corev1.PodSpec, a map[string]string) error {
+	secretName := a[AdmissionWebhookAnnotationCABundleKey]
+	if secretName == "" {
+		return fmt.Errorf("annotation %s must be a secret name", AdmissionWebhookAnnotationCABundleKey)
+	}
+	dir := defaultCABundlePath
+	if v, ok := a[AdmissionWebhookAnnotationCABundlePathKey]; ok {
+		if !path.IsAbs(v) {
+			return fmt.Errorf("annotation %s must be an absolute path", AdmissionWebhookAnnotationCABundlePathKey)
+		}
+		dir = path.Clean(v)
+	}
+	env := false
+	if v, ok := a[AdmissionWebhookAnnotationCABundleEnvKey]; ok {
+		var err error
+		if env, err = strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("annotation %s must be a boolean", AdmissionWebhookAnnotationCABundleEnvKey)
+		}
+	}
+	unmount(spec, caVolumeName, caBundleEnv)
+	mount := func(c *corev1.Container) {
+		c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{Name: caVolumeName, MountPath: dir, ReadOnly: true})
+		if env {
+			c.Env = setEnv(c.Env, caBundleEnv, path.Join(dir, CABundleKey))
+		}
+	}
+	for i := range spec.InitContainers {
+		mount(&spec.InitContainers[i])
+	}
+	for i := range spec.Containers {
+		mount(&spec.Containers[i])
+	}
+	isOptional := true
+	spec.Volumes = setVolume(spec.Volumes, corev1.Volume{
+		Name: caVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: secretName,
+				// the private key of the certificate isn't mounted
+				Items:    []corev1.KeyToPath{{Key: CABundleKey, Path: CABundleKey}},
+				Optional: &isOptional,
+			},
+		},
+	})
+	return nil
+}
@@ -0,0 +1,67 @@
+// /*
+// Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package server
+
+import (
+	"testing"
+
+	"github.com/onmetal/injector/internal/logger"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestMountCABundle(t *testing.T) {
+	a := assert.New(t)
+	spec := testPodSpec()
+	a.NoError(mountCABundle(spec, map[string]string{
+		AdmissionWebhookAnnotationCABundleKey:     "service-tls",
+		AdmissionWebhookAnnotationCABundlePathKey: "/etc/ssl/service",
+		AdmissionWebhookAnnotationCABundleEnvKey:  "true",
+	}))
+	mounts := []corev1.VolumeMount{{Name: caVolumeName, MountPath: "/etc/ssl/service", ReadOnly: true}}
+	env := []corev1.EnvVar{{Name: caBundleEnv, Value: "/etc/ssl/service/ca.crt"}}
+	a.Equal(mounts, spec.InitContainers[0].VolumeMounts)
+	a.Equal(mounts, spec.Containers[0].VolumeMounts)
+	a.Equal(mounts, spec.Containers[1].VolumeMounts)
+	a.Equal(env, spec.Containers[0].Env)
+	a.Len(spec.Volumes, 1)
+	a.Equal("service-tls", spec.Volumes[0].Secret.SecretName)
+	a.Equal([]corev1.KeyToPath{{Key: CABundleKey, Path: CABundleKey}}, spec.Volumes[0].Secret.Items)
+
+	a.Error(mountCABundle(testPodSpec(), map[string]string{AdmissionWebhookAnnotationCABundleKey: ""}))
+	a.Error(mountCABundle(testPodSpec(), map[string]string{
+		AdmissionWebhookAnnotationCABundleKey:     "service-tls",
+		AdmissionWebhookAnnotationCABundlePathKey: "ca",
+	}))
+}
+
+func TestMutateCABundle(t *testing.T) {
+	a := assert.New(t)
+	c := &chiRouter{log: logger.New()}
+	object := []byte(`{"metadata": {"annotations": {"cert.injector.ko/ca-bundle": "service-tls"}},
+		"spec": {"containers": [{"name": "client"}]}}`)
+	resp := c.mutate(&v1.AdmissionReview{Request: &v1.AdmissionRequest{
+		UID:       "1234",
+		Kind:      metav1.GroupVersionKind{Kind: "Pod"},
+		Operation: v1.Create,
+		Object:    pkgruntime.RawExtension{Raw: object},
+	}})
+	a.True(resp.Allowed)
+	a.Contains(string(resp.Patch), `"path":"/spec/containers/0/volumeMounts"`)
+	a.Contains(string(resp.Patch), `"path":"/spec/volumes"`)
+	a.NotContains(string(resp.Patch), volumeName, "the certificate isn't mounted")
+}
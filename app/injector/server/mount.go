@@ -0,0 +1,245 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// AdmissionWebhookAnnotationContainersKey selects the containers the certificate is mounted into by a
+	// comma separated list of names, "*" selects all containers including init containers.
+	// The first container is selected if it's not set.
+	AdmissionWebhookAnnotationContainersKey = "cert.injector.ko/containers"
+	// AdmissionWebhookAnnotationMountPathKey is the absolute directory the certificate is mounted at.
+	AdmissionWebhookAnnotationMountPathKey = "cert.injector.ko/mount-path"
+	// AdmissionWebhookAnnotationCertFileKey is the file name of the certificate in the mount path.
+	AdmissionWebhookAnnotationCertFileKey = "cert.injector.ko/cert-file"
+	// AdmissionWebhookAnnotationKeyFileKey is the file name of the private key in the mount path.
+	AdmissionWebhookAnnotationKeyFileKey = "cert.injector.ko/key-file"
+	// AdmissionWebhookAnnotationEnvKey exposes the paths of the certificate and the private key
+	// as TLS_CERT_FILE and TLS_KEY_FILE environment variables if it's "true".
+	AdmissionWebhookAnnotationEnvKey = "cert.injector.ko/env"
+)
+
+const (
+	allContainers    = "*"
+	defaultMountPath = "/certs"
+	certFileEnv      = "TLS_CERT_FILE"
+	keyFileEnv       = "TLS_KEY_FILE"
+)
+
+// mountOptions describe how the certificate is mounted into the containers of a workload.
+type mountOptions struct {
+	// containers are the names of the selected containers, the first container is selected if it's empty
+	containers []string
+	all        bool
+	path       string
+	certFile   string
+	keyFile    string
+	// renamed maps the keys of the secret to the file names by the items of the volume
+	renamed bool
+	env     bool
+}
+
+// parseMountOptions reads the mount options from the annotations of the workload.
+func parseMountOptions(a map[string]string) (*mountOptions, error) {
+	o := &mountOptions{path: defaultMountPath, certFile: corev1.TLSCertKey, keyFile: corev1.TLSPrivateKeyKey}
+	if v, ok := a[AdmissionWebhookAnnotationContainersKey]; ok {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			switch name {
+			case "":
+			case allContainers:
+				o.all = true
+			default:
+				o.containers = append(o.containers, name)
+			}
+		}
+		if !o.all && len(o.containers) == 0 {
+			return nil, fmt.Errorf("annotation %s doesn't select a container", AdmissionWebhookAnnotationContainersKey)
+		}
+	}
+	if v, ok := a[AdmissionWebhookAnnotationMountPathKey]; ok {
+		if !path.IsAbs(v) {
+			return nil, fmt.Errorf("annotation %s must be an absolute path", AdmissionWebhookAnnotationMountPathKey)
+		}
+		o.path = path.Clean(v)
+	}
+	for _, f := range []struct {
+		key  string
+		file *string
+	}{{AdmissionWebhookAnnotationCertFileKey, &o.certFile}, {AdmissionWebhookAnnotationKeyFileKey, &o.keyFile}} {
+		v, ok := a[f.key]
+		if !ok {
+			continue
+		}
+		if v == "" || v == "." || v == ".." || strings.Contains(v, "/") {
+			return nil, fmt.Errorf("annotation %s must be a file name", f.key)
+		}
+		*f.file = v
+		o.renamed = true
+	}
+	if o.certFile == o.keyFile {
+		return nil, fmt.Errorf("certificate and private key can't have the same file name %s", o.certFile)
+	}
+	if v, ok := a[AdmissionWebhookAnnotationEnvKey]; ok {
+		env, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("annotation %s must be a boolean", AdmissionWebhookAnnotationEnvKey)
+		}
+		o.env = env
+	}
+	return o, nil
+}
+
+// apply mounts the certificate volume into the selected containers of the pod spec.
+func (o *mountOptions) apply(spec *corev1.PodSpec) error {
+	if len(spec.Containers) == 0 {
+		return fmt.Errorf("pod spec has no containers")
+	}
+	switch {
+	case o.all:
+		for i := range spec.InitContainers {
+			o.mount(&spec.InitContainers[i])
+		}
+		for i := range spec.Containers {
+			o.mount(&spec.Containers[i])
+		}
+	case len(o.containers) == 0:
+		o.mount(&spec.Containers[0])
+	default:
+		for _, name := range o.containers {
+			c := findContainer(spec, name)
+			if c == nil {
+				return fmt.Errorf("container %s not found", name)
+			}
+			o.mount(c)
+		}
+	}
+	return nil
+}
+
+func (o *mountOptions) mount(c *corev1.Container) {
+	c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{Name: volumeName, MountPath: o.path, ReadOnly: true})
+	if o.env {
+		c.Env = setEnv(c.Env, certFileEnv, path.Join(o.path, o.certFile))
+		c.Env = setEnv(c.Env, keyFileEnv, path.Join(o.path, o.keyFile))
+	}
+}
+
+// items returns the items of the secret volume which rename the certificate and the private key, nil if they
+// keep their keys. The directory is mounted in both cases, kubelet doesn't update files mounted with subPath.
+func (o *mountOptions) items() []corev1.KeyToPath {
+	if !o.renamed {
+		return nil
+	}
+	return []corev1.KeyToPath{
+		{Key: corev1.TLSCertKey, Path: o.certFile},
+		{Key: corev1.TLSPrivateKeyKey, Path: o.keyFile},
+	}
+}
+
+// findContainer returns the container or init container with the name, nil if there is none.
+func findContainer(spec *corev1.PodSpec, name string) *corev1.Container {
+	for i := range spec.Containers {
+		if spec.Containers[i].Name == name {
+			return &spec.Containers[i]
+		}
+	}
+	for i := range spec.InitContainers {
+		if spec.InitContainers[i].Name == name {
+			return &spec.InitContainers[i]
+		}
+	}
+	return nil
+}
+
+// setEnv sets the environment variable unless the container defines it already.
+func setEnv(env []corev1.EnvVar, name, value string) []corev1.EnvVar {
+	for i := range env {
+		if env[i].Name == name {
+			return env
+		}
+	}
+	return append(env, corev1.EnvVar{Name: name, Value: value})
+}
+
+// unmount removes the mounts of the volume from the containers of the pod spec, together with the
+// environment variables with the names which point into them.
+func unmount(spec *corev1.PodSpec, volume string, envNames ...string) {
+	for i := range spec.InitContainers {
+		unmountContainer(&spec.InitContainers[i], volume, envNames)
+	}
+	for i := range spec.Containers {
+		unmountContainer(&spec.Containers[i], volume, envNames)
+	}
+}
+
+func unmountContainer(c *corev1.Container, volume string, envNames []string) {
+	var paths []string
+	mounts := make([]corev1.VolumeMount, 0, len(c.VolumeMounts))
+	for _, m := range c.VolumeMounts {
+		if m.Name == volume {
+			paths = append(paths, m.MountPath)
+			continue
+		}
+		mounts = append(mounts, m)
+	}
+	if len(paths) == 0 {
+		return
+	}
+	c.VolumeMounts = mounts
+	env := make([]corev1.EnvVar, 0, len(c.Env))
+	for _, e := range c.Env {
+		if !isMountEnv(e, envNames, paths) {
+			env = append(env, e)
+		}
+	}
+	c.Env = env
+}
+
+// isMountEnv reports whether the environment variable has one of the names and points to or into one of the paths.
+func isMountEnv(e corev1.EnvVar, names, paths []string) bool {
+	if e.ValueFrom != nil {
+		return false
+	}
+	for _, name := range names {
+		if e.Name != name {
+			continue
+		}
+		for _, p := range paths {
+			if e.Value == p || path.Dir(e.Value) == p {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// removeContainer removes the container with the name from the pod spec.
+func removeContainer(spec *corev1.PodSpec, name string) {
+	containers := make([]corev1.Container, 0, len(spec.Containers))
+	for _, c := range spec.Containers {
+		if c.Name != name {
+			containers = append(containers, c)
+		}
+	}
+	spec.Containers = containers
+}
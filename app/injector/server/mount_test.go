@@ -0,0 +1,200 @@
+// /*
+// Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/onmetal/injector/internal/logger"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+)
+
+func testPodSpec() *corev1.PodSpec {
+	return &corev1.PodSpec{
+		InitContainers: []corev1.Container{{Name: "init"}},
+		Containers: []corev1.Container{
+			{Name: "app"},
+			{Name: "proxy", Env: []corev1.EnvVar{{Name: certFileEnv, Value: "/etc/proxy.crt"}}},
+		},
+	}
+}
+
+func TestMountDefaults(t *testing.T) {
+	a := assert.New(t)
+	o, err := parseMountOptions(map[string]string{})
+	a.NoError(err)
+	spec := testPodSpec()
+	a.NoError(o.apply(spec))
+	a.Equal([]corev1.VolumeMount{{Name: volumeName, MountPath: "/certs", ReadOnly: true}}, spec.Containers[0].VolumeMounts)
+	a.Empty(spec.Containers[1].VolumeMounts)
+	a.Empty(spec.InitContainers[0].VolumeMounts)
+	a.Empty(spec.Containers[0].Env)
+}
+
+func TestMountContainers(t *testing.T) {
+	a := assert.New(t)
+	o, err := parseMountOptions(map[string]string{
+		AdmissionWebhookAnnotationContainersKey: "proxy, init",
+		AdmissionWebhookAnnotationMountPathKey:  "/etc/tls/",
+		AdmissionWebhookAnnotationCertFileKey:   "server.pem",
+		AdmissionWebhookAnnotationEnvKey:        "true",
+	})
+	a.NoError(err)
+	spec := testPodSpec()
+	a.NoError(o.apply(spec))
+	a.Empty(spec.Containers[0].VolumeMounts)
+	mounts := []corev1.VolumeMount{{Name: volumeName, MountPath: "/etc/tls", ReadOnly: true}}
+	a.Equal(mounts, spec.Containers[1].VolumeMounts, "renamed files are mounted with the directory to get renewals")
+	a.Equal([]corev1.KeyToPath{
+		{Key: corev1.TLSCertKey, Path: "server.pem"},
+		{Key: corev1.TLSPrivateKeyKey, Path: corev1.TLSPrivateKeyKey},
+	}, o.items())
+	a.Equal(mounts, spec.InitContainers[0].VolumeMounts)
+	a.Equal([]corev1.EnvVar{
+		{Name: certFileEnv, Value: "/etc/proxy.crt"},
+		{Name: keyFileEnv, Value: "/etc/tls/tls.key"},
+	}, spec.Containers[1].Env, "existing variables are kept")
+	a.Equal([]corev1.EnvVar{
+		{Name: certFileEnv, Value: "/etc/tls/server.pem"},
+		{Name: keyFileEnv, Value: "/etc/tls/tls.key"},
+	}, spec.InitContainers[0].Env)
+
+	o, err = parseMountOptions(map[string]string{AdmissionWebhookAnnotationContainersKey: "*"})
+	a.NoError(err)
+	spec = testPodSpec()
+	a.NoError(o.apply(spec))
+	a.Len(spec.InitContainers[0].VolumeMounts, 1)
+	a.Len(spec.Containers[0].VolumeMounts, 1)
+	a.Len(spec.Containers[1].VolumeMounts, 1)
+
+	o, err = parseMountOptions(map[string]string{AdmissionWebhookAnnotationContainersKey: "sidecar"})
+	a.NoError(err)
+	a.EqualError(o.apply(testPodSpec()), "container sidecar not found")
+}
+
+func TestMountValidation(t *testing.T) {
+	a := assert.New(t)
+	for _, annotations := range []map[string]string{
+		{AdmissionWebhookAnnotationContainersKey: " , "},
+		{AdmissionWebhookAnnotationMountPathKey: "certs"},
+		{AdmissionWebhookAnnotationCertFileKey: "../tls.crt"},
+		{AdmissionWebhookAnnotationKeyFileKey: ""},
+		{AdmissionWebhookAnnotationCertFileKey: "tls.pem", AdmissionWebhookAnnotationKeyFileKey: "tls.pem"},
+		{AdmissionWebhookAnnotationEnvKey: "yes please"},
+	} {
+		_, err := parseMountOptions(annotations)
+		a.Error(err, annotations)
+	}
+
+	c := &chiRouter{log: logger.New()}
+	resp := c.mutate(&v1.AdmissionReview{Request: &v1.AdmissionRequest{
+		UID:       "1234",
+		Kind:      metav1.GroupVersionKind{Kind: "Pod"},
+		Operation: v1.Create,
+		Object: pkgruntime.RawExtension{Raw: []byte(`{"metadata": {"annotations": {
+			"cert.injector.ko/mount": "true", "cert.injector.ko/cert-name": "test-cert",
+			"cert.injector.ko/containers": "sidecar"}},
+			"spec": {"containers": [{"name": "app"}]}}`)},
+	}})
+	a.False(resp.Allowed)
+	a.Equal(int32(http.StatusUnprocessableEntity), resp.Result.Code)
+	a.Equal("container sidecar not found", resp.Result.Message)
+}
+
+func TestReloader(t *testing.T) {
+	a := assert.New(t)
+	c := &chiRouter{log: logger.New()}
+	resp := c.mutate(&v1.AdmissionReview{Request: &v1.AdmissionRequest{
+		UID:       "1234",
+		Kind:      metav1.GroupVersionKind{Kind: "Deployment"},
+		Operation: v1.Create,
+		Object: pkgruntime.RawExtension{Raw: []byte(`{"metadata": {"annotations": {
+			"cert.injector.ko/mount": "true", "cert.injector.ko/cert-name": "test-cert",
+			"cert.injector.ko/signal-process": "haproxy"}},
+			"spec": {"template": {"spec": {"containers": [{"name": "app"}]}}}}`)},
+	}})
+	a.True(resp.Allowed)
+	a.Contains(string(resp.Patch), `{"op":"add","path":"/spec/template/spec/shareProcessNamespace","value":true}`)
+	a.Contains(string(resp.Patch), `"path":"/spec/template/spec/containers/-"`)
+	a.Contains(string(resp.Patch), `"name":"cert-reloader"`)
+
+	spec := testPodSpec()
+	addReloader(spec, "haproxy", "server.pem")
+	addReloader(spec, "haproxy", "server.pem")
+	a.Len(spec.Containers, 3)
+	a.Equal([]corev1.VolumeMount{{Name: volumeName, MountPath: reloaderMountPath, ReadOnly: true}},
+		spec.Containers[2].VolumeMounts)
+	a.Contains(spec.Containers[2].Env, corev1.EnvVar{Name: "CERT_FILE", Value: reloaderMountPath + "/server.pem"})
+
+	_, err := parseSignalProcess(map[string]string{AdmissionWebhookAnnotationSignalProcessKey: ""})
+	a.Error(err)
+}
+
+func TestMountUpdate(t *testing.T) {
+	a := assert.New(t)
+	c := &chiRouter{log: logger.New()}
+	deployment := []byte(`{"metadata": {"annotations": {
+		"cert.injector.ko/mount": "true", "cert.injector.ko/cert-name": "test-cert", "cert.injector.ko/env": "true"}},
+		"spec": {"template": {"spec": {"containers": [{"name": "app"}, {"name": "proxy"}]}}}}`)
+	review := func(op v1.Operation, raw []byte) *v1.AdmissionResponse {
+		return c.mutate(&v1.AdmissionReview{Request: &v1.AdmissionRequest{
+			UID:       "1234",
+			Kind:      metav1.GroupVersionKind{Kind: "Deployment"},
+			Operation: op,
+			Object:    pkgruntime.RawExtension{Raw: raw},
+		}})
+	}
+	apply := func(raw []byte, resp *v1.AdmissionResponse) []byte {
+		a.True(resp.Allowed)
+		p, err := jsonpatch.DecodePatch(resp.Patch)
+		a.NoError(err)
+		patched, err := p.Apply(raw)
+		a.NoError(err)
+		return patched
+	}
+	deployment = apply(deployment, review(v1.Create, deployment))
+
+	resp := review(v1.Update, deployment)
+	a.True(resp.Allowed)
+	a.Empty(resp.Patch, "unchanged annotations don't change the workload")
+
+	changed, err := jsonpatch.MergePatch(deployment, []byte(`{"metadata": {"annotations": {
+		"cert.injector.ko/containers": "proxy", "cert.injector.ko/mount-path": "/etc/tls",
+		"cert.injector.ko/signal-process": "envoy"}}}`))
+	a.NoError(err)
+	changed = apply(changed, review(v1.Update, changed))
+
+	w, err := getWorkload(KindDeployment, changed)
+	a.NoError(err)
+	app, proxy := w.spec.Containers[0], w.spec.Containers[1]
+	a.Empty(app.VolumeMounts, "the certificate is unmounted from containers which aren't selected anymore")
+	a.Empty(app.Env)
+	a.Equal([]corev1.VolumeMount{{Name: volumeName, MountPath: "/etc/tls", ReadOnly: true}}, proxy.VolumeMounts)
+	a.Equal([]corev1.EnvVar{
+		{Name: certFileEnv, Value: "/etc/tls/tls.crt"},
+		{Name: keyFileEnv, Value: "/etc/tls/tls.key"},
+	}, proxy.Env)
+	a.Len(w.spec.Containers, 3)
+	a.Equal(reloaderContainerName, w.spec.Containers[2].Name)
+	a.Len(w.spec.Volumes, 1)
+
+	resp = review(v1.Update, changed)
+	a.Empty(resp.Patch, "the reloader isn't added twice")
+}
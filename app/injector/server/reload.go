@@ -0,0 +1,100 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/utils/pointer"
+)
+
+const (
+	// AdmissionWebhookAnnotationSignalProcessKey adds a sidecar which sends SIGHUP to the process with
+	// the name when the certificate changes, the containers of the pod share their process namespace.
+	AdmissionWebhookAnnotationSignalProcessKey = "cert.injector.ko/signal-process"
+	// CertificateHashAnnotationKey is stamped into the pod template to roll out a workload with a new certificate.
+	CertificateHashAnnotationKey = "cert.injector.ko/cert-hash"
+)
+
+const (
+	reloaderContainerName = "cert-reloader"
+	// reloaderImageEnv overrides the image of the reloader sidecar, which needs a shell, md5sum and pkill.
+	reloaderImageEnv     = "RELOADER_IMAGE"
+	defaultReloaderImage = "busybox:1.36"
+	reloaderMountPath    = "/etc/cert-reloader"
+	reloaderInterval     = "30"
+)
+
+// reloaderScript sends SIGHUP to the process when the checksum of the mounted certificate changes.
+const reloaderScript = `last=""
+while true; do
+  cur=$(md5sum "$CERT_FILE" 2>/dev/null)
+  if [ -n "$last" ] && [ "$cur" != "$last" ]; then
+    echo "certificate changed, sending SIGHUP to $PROCESS"
+    pkill -HUP -x "$PROCESS"
+  fi
+  last=$cur
+  sleep "$INTERVAL"
+done`
+
+// parseSignalProcess returns the process which is signalled by the reloader sidecar, empty if it's not enabled.
+func parseSignalProcess(a map[string]string) (string, error) {
+	process, ok := a[AdmissionWebhookAnnotationSignalProcessKey]
+	if !ok {
+		return "", nil
+	}
+	if process == "" {
+		return "", fmt.Errorf("annotation %s must be a process name", AdmissionWebhookAnnotationSignalProcessKey)
+	}
+	return process, nil
+}
+
+// addReloader adds the reloader sidecar to the pod spec, it mounts the certificate volume on its own
+// and watches the certificate file with the name.
+func addReloader(spec *corev1.PodSpec, process, certFile string) {
+	for i := range spec.Containers {
+		if spec.Containers[i].Name == reloaderContainerName {
+			return
+		}
+	}
+	image := os.Getenv(reloaderImageEnv)
+	if image == "" {
+		image = defaultReloaderImage
+	}
+	spec.ShareProcessNamespace = pointer.Bool(true)
+	spec.Containers = append(spec.Containers, corev1.Container{
+		Name:    reloaderContainerName,
+		Image:   image,
+		Command: []string{"/bin/sh", "-c", reloaderScript},
+		Env: []corev1.EnvVar{
+			{Name: "CERT_FILE", Value: path.Join(reloaderMountPath, certFile)},
+			{Name: "PROCESS", Value: process},
+			{Name: "INTERVAL", Value: reloaderInterval},
+		},
+		Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("5m"),
+			corev1.ResourceMemory: resource.MustParse("8Mi"),
+		}},
+		VolumeMounts: []corev1.VolumeMount{{Name: volumeName, MountPath: reloaderMountPath, ReadOnly: true}},
+		SecurityContext: &corev1.SecurityContext{
+			AllowPrivilegeEscalation: pointer.Bool(false),
+			// signals can be sent to processes of other users with CAP_KILL only
+			Capabilities: &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}, Add: []corev1.Capability{"KILL"}},
+		},
+	})
+}
@@ -28,6 +28,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/onmetal/injector/app/injector/patch"
+	"github.com/onmetal/injector/internal/logger"
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/admission/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -275,6 +277,55 @@ func TestMutate(t *testing.T) {
 	a.Equal(types.UID("1234"), admissionResponse.Response.UID)
 }
 
+func TestMutateWorkloads(t *testing.T) {
+	a := assert.New(t)
+	c := &chiRouter{log: logger.New()}
+	meta := `"metadata": {"name": "test", "annotations": {"cert.injector.ko/mount": "true", "cert.injector.ko/cert-name": "test-cert"}}`
+	podSpec := `{"containers": [{"name": "nginx", "image": "nginx"}]}`
+	tests := []struct {
+		kind, object, path string
+	}{
+		{"StatefulSet", `{` + meta + `, "spec": {"template": {"spec": ` + podSpec + `}}}`, "/spec/template/spec"},
+		{"DaemonSet", `{` + meta + `, "spec": {"template": {"spec": ` + podSpec + `}}}`, "/spec/template/spec"},
+		{"Job", `{` + meta + `, "spec": {"template": {"spec": ` + podSpec + `}}}`, "/spec/template/spec"},
+		{"CronJob", `{` + meta + `, "spec": {"jobTemplate": {"spec": {"template": {"spec": ` + podSpec + `}}}}}`,
+			"/spec/jobTemplate/spec/template/spec"},
+		{"Pod", `{` + meta + `, "spec": ` + podSpec + `}`, "/spec"},
+	}
+	for _, tt := range tests {
+		resp := c.mutate(&v1.AdmissionReview{Request: &v1.AdmissionRequest{
+			UID:       "1234",
+			Kind:      metav1.GroupVersionKind{Kind: tt.kind},
+			Operation: v1.Create,
+			Object:    pkgruntime.RawExtension{Raw: []byte(tt.object)},
+		}})
+		a.True(resp.Allowed, tt.kind)
+		var ops []patch.Operation
+		a.NoError(json.Unmarshal(resp.Patch, &ops), tt.kind)
+		if a.Len(ops, 3, tt.kind) {
+			a.Equal(patch.Operation{Op: "test", Path: tt.path + "/containers/0/name", Value: "nginx"}, ops[0])
+			a.Equal(tt.path+"/containers/0/volumeMounts", ops[1].Path)
+			a.Equal(tt.path+"/volumes", ops[2].Path)
+		}
+	}
+
+	resp := c.mutate(&v1.AdmissionReview{Request: &v1.AdmissionRequest{
+		UID:       "1234",
+		Kind:      metav1.GroupVersionKind{Kind: "Pod"},
+		Operation: v1.Update,
+		Object:    pkgruntime.RawExtension{Raw: []byte(tests[4].object)},
+	}})
+	a.True(resp.Allowed)
+	a.Empty(resp.Patch, "pod spec is immutable")
+
+	resp = c.mutate(&v1.AdmissionReview{Request: &v1.AdmissionRequest{
+		UID:    "1234",
+		Kind:   metav1.GroupVersionKind{Kind: "ReplicationController"},
+		Object: pkgruntime.RawExtension{Raw: []byte(`{}`)},
+	}})
+	a.False(resp.Allowed)
+}
+
 func setupEnvs(t *testing.T) {
 	/* self-signed cert might be created by openssl command:
 	openssl req -nodes -x509 -newkey rsa:4096 -keyout certs/key.pem -out certs/cert.pem -days 10000 -subj '/CN=localhost' */
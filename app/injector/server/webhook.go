@@ -22,7 +22,6 @@ import (
 	"github.com/onmetal/injector/app/injector/patch"
 
 	v1 "k8s.io/api/admission/v1"
-	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -35,11 +34,6 @@ var (
 	deserializer  = codecs.UniversalDeserializer()
 )
 
-const (
-	jsonSpecContainers = "/spec/template/spec/containers"
-	jsonSpecVolumes    = "/spec/template/spec/volumes"
-)
-
 const (
 	AdmissionWebhookAnnotationInjectKey = "cert.injector.ko/mount"
 	AdmissionWebhookAnnotationCertKey   = "cert.injector.ko/cert-name"
@@ -90,81 +84,135 @@ func (c *chiRouter) mutateHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (c *chiRouter) mutate(ar *v1.AdmissionReview) *v1.AdmissionResponse {
-	deployment, err := getDeployment(ar.Request.Object.Raw)
+	w, err := getWorkload(ar.Request.Kind.Kind, ar.Request.Object.Raw)
 	if err != nil {
-		c.log.Error("can't unmarshal deployment from admission request", err)
+		c.log.Error("can't unmarshal workload from admission request", err)
 		return &v1.AdmissionResponse{Allowed: false, UID: ar.Request.UID, Result: &metav1.Status{Message: err.Error()}}
 	}
 
-	if !isMutationRequired(deployment.Annotations, deployment.Spec.Template.Spec.Volumes) {
+	mountCert := isMutationRequired(w.meta.Annotations)
+	mountCA := isCABundleRequired(w.meta.Annotations)
+	if !mountCert && !mountCA {
+		return &v1.AdmissionResponse{Allowed: true, UID: ar.Request.UID}
+	}
+	if ar.Request.Operation == v1.Update && immutablePodSpec(w.kind) {
+		// the pod spec of pods and jobs can't be changed after creation
 		return &v1.AdmissionResponse{Allowed: true, UID: ar.Request.UID}
 	}
 
-	secretName, ok := deployment.Annotations[AdmissionWebhookAnnotationCertKey]
-	if !ok {
-		return &v1.AdmissionResponse{
-			Allowed: false, UID: ar.Request.UID,
-			Result: &metav1.Status{Message: "secret with certs not provided"},
+	original := w.spec.DeepCopy()
+	if mountCert {
+		secretName, ok := w.meta.Annotations[AdmissionWebhookAnnotationCertKey]
+		if !ok {
+			return &v1.AdmissionResponse{
+				Allowed: false, UID: ar.Request.UID,
+				Result: &metav1.Status{Message: "secret with certs not provided"},
+			}
+		}
+		if err := mountCertificate(w.spec, secretName, w.meta.Annotations); err != nil {
+			return invalid(ar, err)
+		}
+	}
+	if mountCA {
+		if err := mountCABundle(w.spec, w.meta.Annotations); err != nil {
+			return invalid(ar, err)
 		}
 	}
 
-	body, err := mutateDeployment(secretName, deployment)
+	body, err := patchWorkload(original, w)
 	if err != nil {
-		c.log.Error("can't mutate deployment", err)
+		c.log.Error("can't mutate workload", err)
 		return &v1.AdmissionResponse{
 			Allowed: false, UID: ar.Request.UID,
-			Result: &metav1.Status{Message: "can't mutate deployment"},
+			Result: &metav1.Status{Message: fmt.Sprintf("can't mutate %s", w.kind)},
 		}
 	}
 
+	if body == nil {
+		return &v1.AdmissionResponse{Allowed: true, UID: ar.Request.UID}
+	}
 	return &v1.AdmissionResponse{Allowed: true, Patch: body, UID: ar.Request.UID, PatchType: getPatchType()}
 }
 
-func getDeployment(req []byte) (*appsv1.Deployment, error) {
-	d := &appsv1.Deployment{}
-	if err := json.Unmarshal(req, d); err != nil {
-		return nil, err
+// invalid rejects the admission request because of invalid annotations.
+func invalid(ar *v1.AdmissionReview, err error) *v1.AdmissionResponse {
+	return &v1.AdmissionResponse{
+		Allowed: false, UID: ar.Request.UID,
+		Result: &metav1.Status{Message: err.Error(), Reason: metav1.StatusReasonInvalid, Code: http.StatusUnprocessableEntity},
 	}
-	return d, nil
 }
 
-func isMutationRequired(a map[string]string, volumes []corev1.Volume) bool {
-	for v := range volumes {
-		if volumes[v].Name == volumeName {
-			return false
-		}
-	}
+func isMutationRequired(a map[string]string) bool {
 	value, ok := a[AdmissionWebhookAnnotationInjectKey]
 	return ok && value == "true"
 }
 
-func mutateDeployment(secretName string, deployment *appsv1.Deployment) ([]byte, error) {
-	var operations []patch.Operation
-	containers := updateContainer(deployment.Spec.Template.Spec.Containers)
-	volume := addVolume(deployment.Spec.Template.Spec.Volumes, secretName)
-	operations = append(operations,
-		patch.AddPatchOperation(jsonSpecContainers, containers),
-		patch.AddPatchOperation(jsonSpecVolumes, volume))
-	return json.Marshal(operations)
-}
-
-func updateContainer(containers []corev1.Container) []corev1.Container {
-	containers[0].VolumeMounts = append(containers[0].VolumeMounts,
-		corev1.VolumeMount{Name: volumeName, MountPath: "/certs", ReadOnly: true})
-	return containers
-}
-
-func addVolume(volumes []corev1.Volume, name string) []corev1.Volume {
+// mountCertificate mounts the certificate secret into the selected containers of the pod spec. A previous
+// mount is replaced, so changed annotations are applied on update.
+func mountCertificate(spec *corev1.PodSpec, secretName string, a map[string]string) error {
+	opts, err := parseMountOptions(a)
+	if err != nil {
+		return err
+	}
+	process, err := parseSignalProcess(a)
+	if err != nil {
+		return err
+	}
+	removeContainer(spec, reloaderContainerName)
+	unmount(spec, volumeName, certFileEnv, keyFileEnv)
+	if err := opts.apply(spec); err != nil {
+		return err
+	}
+	if process != "" {
+		addReloader(spec, process, opts.certFile)
+	}
 	isOptional := true
-	return append(volumes, corev1.Volume{
+	spec.Volumes = setVolume(spec.Volumes, corev1.Volume{
 		Name: volumeName,
 		VolumeSource: corev1.VolumeSource{
 			Secret: &corev1.SecretVolumeSource{
-				SecretName: name,
+				SecretName: secretName,
+				Items:      opts.items(),
 				Optional:   &isOptional,
 			},
 		},
 	})
+	return nil
+}
+
+// UnmountCertificate removes the certificate volume, its mounts and the reloader sidecar from the pod spec
+// of a workload which isn't a target of the certificate anymore.
+func UnmountCertificate(spec *corev1.PodSpec) {
+	removeContainer(spec, reloaderContainerName)
+	unmount(spec, volumeName, certFileEnv, keyFileEnv)
+	volumes := make([]corev1.Volume, 0, len(spec.Volumes))
+	for _, v := range spec.Volumes {
+		if v.Name != volumeName {
+			volumes = append(volumes, v)
+		}
+	}
+	spec.Volumes = volumes
+}
+
+// patchWorkload returns the patch from the original to the mutated pod spec of the workload,
+// nil if the pod spec isn't changed.
+func patchWorkload(original *corev1.PodSpec, w *workload) ([]byte, error) {
+	operations, err := patch.Diff(w.specPath, original, w.spec)
+	if err != nil || len(operations) == 0 {
+		return nil, err
+	}
+	return json.Marshal(operations)
+}
+
+// setVolume replaces the volume with the same name or adds it.
+func setVolume(volumes []corev1.Volume, volume corev1.Volume) []corev1.Volume {
+	for i := range volumes {
+		if volumes[i].Name == volume.Name {
+			volumes[i] = volume
+			return volumes
+		}
+	}
+	return append(volumes, volume)
 }
 
 func getPatchType() *v1.PatchType {
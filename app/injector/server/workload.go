@@ -0,0 +1,98 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Workload kinds the webhook mutates.
+const (
+	KindDeployment  = "Deployment"
+	KindStatefulSet = "StatefulSet"
+	KindDaemonSet   = "DaemonSet"
+	KindJob         = "Job"
+	KindCronJob     = "CronJob"
+	KindPod         = "Pod"
+)
+
+// JSON pointers of the pod spec in the workload kinds.
+const (
+	podTemplateSpecPath = "/spec/template/spec"
+	jobTemplateSpecPath = "/spec/jobTemplate/spec/template/spec"
+	podSpecPath         = "/spec"
+)
+
+// workload is the pod spec of an admitted object and its location in the object.
+type workload struct {
+	kind     string
+	meta     *metav1.ObjectMeta
+	spec     *corev1.PodSpec
+	specPath string
+}
+
+// getWorkload unmarshals the object of the admission request according to its kind.
+func getWorkload(kind string, raw []byte) (*workload, error) {
+	switch {
+	case strings.EqualFold(kind, KindDeployment):
+		d := &appsv1.Deployment{}
+		if err := json.Unmarshal(raw, d); err != nil {
+			return nil, err
+		}
+		return &workload{KindDeployment, &d.ObjectMeta, &d.Spec.Template.Spec, podTemplateSpecPath}, nil
+	case strings.EqualFold(kind, KindStatefulSet):
+		s := &appsv1.StatefulSet{}
+		if err := json.Unmarshal(raw, s); err != nil {
+			return nil, err
+		}
+		return &workload{KindStatefulSet, &s.ObjectMeta, &s.Spec.Template.Spec, podTemplateSpecPath}, nil
+	case strings.EqualFold(kind, KindDaemonSet):
+		d := &appsv1.DaemonSet{}
+		if err := json.Unmarshal(raw, d); err != nil {
+			return nil, err
+		}
+		return &workload{KindDaemonSet, &d.ObjectMeta, &d.Spec.Template.Spec, podTemplateSpecPath}, nil
+	case strings.EqualFold(kind, KindJob):
+		j := &batchv1.Job{}
+		if err := json.Unmarshal(raw, j); err != nil {
+			return nil, err
+		}
+		return &workload{KindJob, &j.ObjectMeta, &j.Spec.Template.Spec, podTemplateSpecPath}, nil
+	case strings.EqualFold(kind, KindCronJob):
+		c := &batchv1.CronJob{}
+		if err := json.Unmarshal(raw, c); err != nil {
+			return nil, err
+		}
+		return &workload{KindCronJob, &c.ObjectMeta, &c.Spec.JobTemplate.Spec.Template.Spec, jobTemplateSpecPath}, nil
+	case strings.EqualFold(kind, KindPod):
+		p := &corev1.Pod{}
+		if err := json.Unmarshal(raw, p); err != nil {
+			return nil, err
+		}
+		return &workload{KindPod, &p.ObjectMeta, &p.Spec, podSpecPath}, nil
+	}
+	return nil, fmt.Errorf("kind %s isn't supported", kind)
+}
+
+// immutablePodSpec returns whether the pod spec of the kind can only be set on creation.
+func immutablePodSpec(kind string) bool {
+	return kind == KindPod || kind == KindJob
+}
@@ -0,0 +1,366 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certificate
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-logr/logr"
+	"github.com/onmetal/injector/api/v1alpha1"
+	injerr "github.com/onmetal/injector/internal/errors"
+	"github.com/onmetal/injector/internal/issuer"
+	"github.com/onmetal/injector/internal/kubernetes"
+	"github.com/onmetal/injector/internal/renewal"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// afterRateLimit1Day is used if the ACME server doesn't tell when to retry.
+	afterRateLimit1Day     = 24 * time.Hour
+	afterRejection1Day     = 24 * time.Hour
+	afterFailure1Hour      = time.Hour
+	afterServerFailure5Min = 5 * time.Minute
+	afterSelfCheck10Min    = 10 * time.Minute
+	// afterIssuerNotReady5Min waits for the issuer controller to register the account.
+	afterIssuerNotReady5Min = 5 * time.Minute
+	// minRenewalInterval prevents a renewal loop for certificates which are already due when issued.
+	minRenewalInterval = time.Minute
+)
+
+type Reconciler struct {
+	client.Client
+
+	Scheme *runtime.Scheme
+	// order obtains a new certificate or renews the current one, it's replaced in tests
+	order func(ctx context.Context, l logr.Logger, crt *v1alpha1.Certificate, renew bool) (*certificate.Resource, error)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.Certificate{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.certificatesForSecret)).
+		Watches(&source.Kind{Type: &v1alpha1.Issuer{}}, handler.EnqueueRequestsFromMapFunc(r.certificatesForIssuer),
+			builder.WithPredicates(issuerBecameReady())).
+		Watches(&source.Kind{Type: &v1alpha1.ClusterIssuer{}}, handler.EnqueueRequestsFromMapFunc(r.certificatesForIssuer),
+			builder.WithPredicates(issuerBecameReady())).
+		Complete(r)
+}
+
+//+kubebuilder:rbac:groups=cert.injector.ko,resources=certificates,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=cert.injector.ko,resources=certificates/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=cert.injector.ko,resources=certificates/finalizers,verbs=update
+//+kubebuilder:rbac:groups=cert.injector.ko,resources=issuers;clusterissuers,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;daemonsets,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=batch,resources=jobs;cronjobs,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch;create;delete;deletecollection
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;delete;deletecollection
+//+kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;delete;deletecollection
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	reqLog := log.FromContext(ctx)
+
+	crt := &v1alpha1.Certificate{}
+	if err := r.Get(ctx, req.NamespacedName, crt); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	current, err := renewal.GetCurrentCertificate(ctx, r.Client, crt)
+	if err != nil && !apierr.IsNotFound(err) {
+		reqLog.Info("can't get current certificate", "error", err)
+		return ctrl.Result{}, err
+	}
+	// only the ACME order depends on the renewal time, the secret and the workloads are reconciled on every pass,
+	// so changes of the certificate are applied and failed injections are retried
+	cert, reason := current, ""
+	x509Cert, ok := issued(current, crt)
+	ok = ok && r.issuedForRequest(ctx, crt, x509Cert)
+	var renewAt time.Time
+	var recheck time.Duration
+	if ok {
+		renewAt, recheck = r.renewalTime(ctx, reqLog, crt, x509Cert)
+	}
+	if !ok || time.Until(renewAt) <= 0 {
+		reason = v1alpha1.CertificateReasonIssued
+		if ok {
+			reason = v1alpha1.CertificateReasonRenewed
+		}
+		// a certificate which can't be stored isn't ordered, it would be ordered again on every retry
+		if err := kubernetes.ValidateOutputs(ctx, r.Client, crt); err != nil {
+			return r.failed(ctx, reqLog, crt, err)
+		}
+		if cert, err = r.orderCertificate(ctx, reqLog, crt, ok); err != nil {
+			return r.failed(ctx, reqLog, crt, err)
+		}
+		if x509Cert, err = certcrypto.ParsePEMCertificate(cert.Certificate); err != nil {
+			return ctrl.Result{}, err
+		}
+		renewAt, recheck = r.renewalTime(ctx, reqLog, crt, x509Cert)
+	}
+
+	k8s := kubernetes.New(ctx, r.Client, reqLog, cert, crt)
+	if gi, err := issuer.GetIssuer(ctx, r.Client, crt); err == nil {
+		ca, err := issuer.CABundle(gi.GetSpec().ACME, cert.Certificate)
+		if err != nil {
+			reqLog.Info("can't get CA bundle of certificate", "error", err)
+			return ctrl.Result{}, err
+		}
+		k8s.WithCABundle(ca)
+	}
+	if err := k8s.CreateOrUpdateSecretForCertificate(); err != nil {
+		reqLog.Info("can't create secret for certificate", "error", err)
+		return ctrl.Result{}, err
+	}
+	if err := k8s.InjectCertIntoWorkloads(); err != nil && !injerr.IsNotRequired(err) {
+		reqLog.Info("can't inject certificate into workloads", "error", err)
+		return ctrl.Result{}, err
+	}
+
+	if err := r.setIssued(ctx, crt, x509Cert, renewAt, reason); err != nil {
+		return ctrl.Result{}, err
+	}
+	reqLog.Info("reconciliation finished", "renewAt", renewAt)
+	wait := time.Until(renewAt)
+	if wait < minRenewalInterval {
+		wait = minRenewalInterval
+	}
+	return ctrl.Result{RequeueAfter: shortest(wait, recheck)}, nil
+}
+
+// renewalTime returns the time at which the certificate is renewed and the interval after which it's checked again.
+// The renewal window suggested by the ACME server takes precedence over the lifetime of the certificate,
+// it's checked regularly to react to early renewals signalled by the CA, e.g. for revocations.
+func (r *Reconciler) renewalTime(ctx context.Context, l logr.Logger, crt *v1alpha1.Certificate,
+	x509Cert *x509.Certificate) (time.Time, time.Duration) {
+	renewAt := renewal.RenewalTime(x509Cert, crt)
+	gi, err := issuer.GetIssuer(ctx, r.Client, crt)
+	if err != nil {
+		return renewAt, 0
+	}
+	acme := gi.GetSpec().ACME
+	if acme.DisableRenewalInfo {
+		return renewAt, 0
+	}
+	httpClient, err := issuer.NewHTTPClient(acme)
+	if err != nil {
+		return renewAt, 0
+	}
+	ri, err := renewal.GetRenewalInfo(ctx, httpClient, acme.Server, x509Cert)
+	if err != nil {
+		if injerr.IsNotExist(err) {
+			return renewAt, 0
+		}
+		l.Info("can't get renewal information", "error", err)
+		return renewAt, afterFailure1Hour
+	}
+	if ri.ExplanationURL != "" {
+		l.Info("renewal window is explained by the ACME server", "url", ri.ExplanationURL)
+	}
+	return ri.RenewalTime(x509Cert), ri.RetryAfter
+}
+
+// shortest returns the shortest of the positive durations.
+func shortest(d, other time.Duration) time.Duration {
+	if other > 0 && other < d {
+		return other
+	}
+	return d
+}
+
+// orderCertificate obtains a new certificate or renews the current one.
+func (r *Reconciler) orderCertificate(ctx context.Context, l logr.Logger, crt *v1alpha1.Certificate,
+	renew bool) (*certificate.Resource, error) {
+	if r.order != nil {
+		return r.order(ctx, l, crt, renew)
+	}
+	if renew {
+		return r.renew(ctx, l, crt)
+	}
+	return r.obtain(ctx, l, crt)
+}
+
+func (r *Reconciler) obtain(ctx context.Context, l logr.Logger, crt *v1alpha1.Certificate) (*certificate.Resource, error) {
+	i, err := issuer.New(ctx, r.Client, l, crt)
+	if err != nil {
+		l.Info("can't create issuer", "error", err)
+		return nil, err
+	}
+	if solverErr := i.RegisterChallengeProvider(); solverErr != nil {
+		l.Info("can't register http solver", "error", solverErr)
+		return nil, solverErr
+	}
+	return i.Obtain()
+}
+
+func (r *Reconciler) renew(ctx context.Context, l logr.Logger, crt *v1alpha1.Certificate) (*certificate.Resource, error) {
+	i, err := renewal.New(ctx, r.Client, l, crt)
+	if err != nil {
+		l.Info("can't create renewer", "error", err)
+		return nil, err
+	}
+	if solverErr := i.RegisterChallengeProvider(); solverErr != nil {
+		l.Info("can't register http solver", "error", solverErr)
+		return nil, solverErr
+	}
+	return i.Renew()
+}
+
+func (r *Reconciler) failed(ctx context.Context, l logr.Logger, crt *v1alpha1.Certificate, err error) (ctrl.Result, error) {
+	l.Info("can't obtain certificate", "error", err)
+	reason, requeueAfter := v1alpha1.CertificateReasonFailed, afterFailure1Hour
+	if acmeErr, ok := injerr.AsACME(err); ok {
+		reason, requeueAfter = acmeRequeue(acmeErr)
+	} else if injerr.IsSelfCheckFailed(err) {
+		reason, requeueAfter = v1alpha1.CertificateReasonSelfCheckFailed, afterSelfCheck10Min
+	} else if injerr.IsNotExist(err) {
+		reason = v1alpha1.CertificateReasonIssuerMissing
+	} else if injerr.IsNotReady(err) {
+		// the certificate is also retried by the watch once the issuer is ready
+		reason, requeueAfter = v1alpha1.CertificateReasonIssuerNotReady, afterIssuerNotReady5Min
+	}
+	now := metav1.Now()
+	crt.Status.LastFailureTime = &now
+	crt.Status.LastFailureMessage = err.Error()
+	meta.SetStatusCondition(&crt.Status.Conditions, metav1.Condition{
+		Type:               v1alpha1.CertificateConditionReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             reason,
+		Message:            err.Error(),
+		ObservedGeneration: crt.Generation,
+	})
+	if statusErr := r.Status().Update(ctx, crt); statusErr != nil {
+		return ctrl.Result{}, statusErr
+	}
+	l.Info("reconciliation finished")
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// acmeRequeue returns the condition reason and the requeue interval for the problem type of the ACME server.
+func acmeRequeue(acmeErr *injerr.ACMEError) (string, time.Duration) {
+	switch {
+	case acmeErr.HasType(injerr.ACMEProblemRateLimited):
+		if wait := time.Until(acmeErr.RetryAfter); wait > 0 {
+			return v1alpha1.CertificateReasonRateLimited, wait
+		}
+		return v1alpha1.CertificateReasonRateLimited, afterRateLimit1Day
+	case acmeErr.HasType(injerr.ACMEProblemBadNonce), acmeErr.HasType(injerr.ACMEProblemServerInternal):
+		return v1alpha1.CertificateReasonFailed, afterServerFailure5Min
+	case acmeErr.HasType(injerr.ACMEProblemRejectedIdentifier), acmeErr.HasType(injerr.ACMEProblemUnsupportedIdentifier),
+		acmeErr.HasType(injerr.ACMEProblemCAA), acmeErr.HasType(injerr.ACMEProblemBadCSR):
+		// retrying doesn't help until the certificate or the DNS records are changed
+		return v1alpha1.CertificateReasonRejected, afterRejection1Day
+	case acmeErr.HasType(injerr.ACMEProblemUnauthorized), acmeErr.HasType(injerr.ACMEProblemDNS),
+		acmeErr.HasType(injerr.ACMEProblemConnection), acmeErr.HasType(injerr.ACMEProblemTLS),
+		acmeErr.HasType(injerr.ACMEProblemIncorrectResponse):
+		return v1alpha1.CertificateReasonValidationFailed, afterFailure1Hour
+	}
+	return v1alpha1.CertificateReasonFailed, afterFailure1Hour
+}
+
+// setIssued reflects the stored certificate in the status, an empty reason keeps the current one.
+func (r *Reconciler) setIssued(ctx context.Context, crt *v1alpha1.Certificate, x509Cert *x509.Certificate,
+	renewAt time.Time, reason string) error {
+	status := crt.Status.DeepCopy()
+	notBefore, notAfter := metav1.NewTime(x509Cert.NotBefore), metav1.NewTime(x509Cert.NotAfter)
+	renewalTime := metav1.NewTime(renewAt)
+	status.NotBefore = &notBefore
+	status.NotAfter = &notAfter
+	status.RenewalTime = &renewalTime
+	status.SerialNumber = fmt.Sprintf("%x", x509Cert.SerialNumber)
+	if reason == "" {
+		reason = v1alpha1.CertificateReasonIssued
+		if c := meta.FindStatusCondition(status.Conditions, v1alpha1.CertificateConditionReady); c != nil &&
+			c.Status == metav1.ConditionTrue {
+			reason = c.Reason
+		}
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               v1alpha1.CertificateConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             reason,
+		Message:            fmt.Sprintf("certificate is stored in secret %s", crt.Spec.SecretName),
+		ObservedGeneration: crt.Generation,
+	})
+	if equality.Semantic.DeepEqual(status, &crt.Status) {
+		return nil
+	}
+	crt.Status = *status
+	return r.Status().Update(ctx, crt)
+}
+
+// issuedForRequest reports whether the certificate was issued for the public key of the current signing request,
+// a changed request is issued immediately. It's true for certificates without signing request.
+func (r *Reconciler) issuedForRequest(ctx context.Context, crt *v1alpha1.Certificate, x509Cert *x509.Certificate) bool {
+	if crt.Spec.CSR == nil {
+		return true
+	}
+	csr, err := issuer.GetCertificateRequest(ctx, r.Client, crt)
+	if err != nil {
+		return false
+	}
+	pub, ok := x509Cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && pub.Equal(csr.PublicKey)
+}
+
+// issued returns the parsed current certificate if it was issued for the requested domains.
+func issued(current *certificate.Resource, crt *v1alpha1.Certificate) (*x509.Certificate, bool) {
+	if current == nil || len(current.Certificate) == 0 {
+		return nil, false
+	}
+	x509Cert, err := certcrypto.ParsePEMCertificate(current.Certificate)
+	if err != nil {
+		return nil, false
+	}
+	requested := make(map[string]struct{}, len(crt.Spec.Domains))
+	for _, d := range crt.Spec.Domains {
+		requested[d] = struct{}{}
+	}
+	actual := make(map[string]struct{}, len(requested))
+	for _, d := range certcrypto.ExtractDomains(x509Cert) {
+		if _, ok := requested[d]; !ok {
+			return nil, false
+		}
+		actual[d] = struct{}{}
+	}
+	if len(actual) != len(requested) {
+		return nil, false
+	}
+	return x509Cert, true
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certificate
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-logr/logr"
+	"github.com/onmetal/injector/api/v1alpha1"
+	"github.com/onmetal/injector/app/injector/server"
+	injerr "github.com/onmetal/injector/internal/errors"
+	"github.com/onmetal/injector/internal/kubernetes"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// testCertificate returns a self-signed certificate of the domain which is valid from notBefore to notAfter.
+func testCertificate(t *testing.T, domain string, notBefore, notAfter time.Time) *certificate.Resource {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	return &certificate.Resource{
+		Certificate: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		PrivateKey:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// failingClient fails updates of deployments while fail is set.
+type failingClient struct {
+	client.Client
+	fail bool
+}
+
+func (c *failingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if _, ok := obj.(*appsv1.Deployment); ok && c.fail {
+		return errors.New("conflict")
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+// orderRecorder issues certificates of 90 days for the order function of the reconciler and records the orders.
+type orderRecorder struct {
+	t      *testing.T
+	orders []bool
+}
+
+func (o *orderRecorder) order(_ context.Context, _ logr.Logger, crt *v1alpha1.Certificate,
+	renew bool) (*certificate.Resource, error) {
+	o.orders = append(o.orders, renew)
+	return testCertificate(o.t, crt.Spec.Domains[0], time.Now(), time.Now().Add(90*24*time.Hour)), nil
+}
+
+func reconcileTest(t *testing.T, objs ...client.Object) (*Reconciler, *failingClient, *orderRecorder) {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	assert.NoError(t, clientgoscheme.AddToScheme(scheme))
+	assert.NoError(t, v1alpha1.AddToScheme(scheme))
+	objs = append(objs,
+		&v1alpha1.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+			Spec: v1alpha1.CertificateSpec{
+				Domains:    []string{"example.com"},
+				SecretName: "app-tls",
+				Targets:    []v1alpha1.WorkloadReference{{Name: "app"}},
+			},
+		},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}},
+	)
+	c := &failingClient{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()}
+	o := &orderRecorder{t: t}
+	return &Reconciler{Client: c, Scheme: scheme, order: o.order}, c, o
+}
+
+func getCertificate(t *testing.T, c client.Client) *v1alpha1.Certificate {
+	t.Helper()
+	crt := &v1alpha1.Certificate{}
+	assert.NoError(t, c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "app"}, crt))
+	return crt
+}
+
+func getDeployment(t *testing.T, c client.Client, name string) *appsv1.Deployment {
+	t.Helper()
+	d := &appsv1.Deployment{}
+	assert.NoError(t, c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: name}, d))
+	return d
+}
+
+func TestReconcileFirstIssuance(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	r, c, o := reconcileTest(t)
+
+	res, err := r.Reconcile(ctx, request("default", "app"))
+	a.NoError(err)
+	a.Equal([]bool{false}, o.orders)
+	a.Greater(res.RequeueAfter, 24*time.Hour)
+
+	sec := &corev1.Secret{}
+	a.NoError(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "app-tls"}, sec))
+	a.NotEmpty(sec.Data[corev1.TLSCertKey])
+	a.NotEmpty(sec.Data[corev1.TLSPrivateKeyKey])
+	a.Equal("app", sec.Labels[kubernetes.CertificateNameLabelKey])
+	a.Equal("app-tls", getDeployment(t, c, "app").Annotations[server.AdmissionWebhookAnnotationCertKey])
+	ready := meta.FindStatusCondition(getCertificate(t, c).Status.Conditions, v1alpha1.CertificateConditionReady)
+	a.Equal(metav1.ConditionTrue, ready.Status)
+	a.Equal(v1alpha1.CertificateReasonIssued, ready.Reason)
+}
+
+func TestReconcileIssuedNotDue(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	r, c, o := reconcileTest(t)
+	_, err := r.Reconcile(ctx, request("default", "app"))
+	a.NoError(err)
+
+	// targets and the secret template of the issued certificate are applied without an order
+	crt := getCertificate(t, c)
+	crt.Spec.Targets = []v1alpha1.WorkloadReference{{Name: "web"}}
+	crt.Spec.SecretTemplate = &v1alpha1.CertificateSecretTemplate{Labels: map[string]string{"backup": "true"}}
+	a.NoError(c.Update(ctx, crt))
+	_, err = r.Reconcile(ctx, request("default", "app"))
+	a.NoError(err)
+	a.Len(o.orders, 1)
+
+	sec := &corev1.Secret{}
+	a.NoError(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "app-tls"}, sec))
+	a.Equal("true", sec.Labels["backup"])
+	a.Equal("app-tls", getDeployment(t, c, "web").Annotations[server.AdmissionWebhookAnnotationCertKey])
+	a.NotContains(getDeployment(t, c, "app").Annotations, server.AdmissionWebhookAnnotationCertKey)
+
+	// a changed secret name moves the certificate
+	crt = getCertificate(t, c)
+	crt.Spec.SecretName = "web-tls"
+	a.NoError(c.Update(ctx, crt))
+	_, err = r.Reconcile(ctx, request("default", "app"))
+	a.NoError(err)
+	a.Len(o.orders, 1)
+	renamed := &corev1.Secret{}
+	a.NoError(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "web-tls"}, renamed))
+	a.Equal(sec.Data[corev1.TLSCertKey], renamed.Data[corev1.TLSCertKey])
+	a.Equal("web-tls", getDeployment(t, c, "web").Annotations[server.AdmissionWebhookAnnotationCertKey])
+}
+
+func TestReconcileRenewalDue(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	expiring := testCertificate(t, "example.com", time.Now().Add(-89*24*time.Hour), time.Now().Add(24*time.Hour))
+	r, c, o := reconcileTest(t, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-tls", Namespace: "default"},
+		Data:       map[string][]byte{corev1.TLSCertKey: expiring.Certificate, corev1.TLSPrivateKeyKey: expiring.PrivateKey},
+	})
+
+	_, err := r.Reconcile(ctx, request("default", "app"))
+	a.NoError(err)
+	a.Equal([]bool{true}, o.orders)
+	sec := &corev1.Secret{}
+	a.NoError(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "app-tls"}, sec))
+	a.NotEqual(expiring.Certificate, sec.Data[corev1.TLSCertKey])
+	ready := meta.FindStatusCondition(getCertificate(t, c).Status.Conditions, v1alpha1.CertificateConditionReady)
+	a.Equal(v1alpha1.CertificateReasonRenewed, ready.Reason)
+}
+
+func TestReconcileFailureAfterOrder(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	r, c, o := reconcileTest(t)
+
+	c.fail = true
+	_, err := r.Reconcile(ctx, request("default", "app"))
+	a.Error(err, "the injection fails after the order")
+	a.Nil(meta.FindStatusCondition(getCertificate(t, c).Status.Conditions, v1alpha1.CertificateConditionReady))
+
+	c.fail = false
+	_, err = r.Reconcile(ctx, request("default", "app"))
+	a.NoError(err)
+	a.Len(o.orders, 1, "the stored certificate isn't ordered again")
+	a.Equal("app-tls", getDeployment(t, c, "app").Annotations[server.AdmissionWebhookAnnotationCertKey])
+	a.True(meta.IsStatusConditionTrue(getCertificate(t, c).Status.Conditions, v1alpha1.CertificateConditionReady))
+}
+
+func TestReconcileInvalidOutputs(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	r, c, o := reconcileTest(t)
+	crt := getCertificate(t, c)
+	crt.Spec.Keystores = &v1alpha1.CertificateKeystores{
+		PKCS12: &v1alpha1.CertificateKeystore{PasswordSecretRef: v1alpha1.SecretKeySelector{Name: "missing"}},
+	}
+	a.NoError(c.Update(ctx, crt))
+
+	res, err := r.Reconcile(ctx, request("default", "app"))
+	a.NoError(err)
+	a.Equal(afterFailure1Hour, res.RequeueAfter)
+	a.Empty(o.orders, "a certificate which can't be stored isn't ordered")
+	a.False(meta.IsStatusConditionTrue(getCertificate(t, c).Status.Conditions, v1alpha1.CertificateConditionReady))
+}
+
+func TestReconcileIssuerNotReady(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	r, c, _ := reconcileTest(t)
+	r.order = func(context.Context, logr.Logger, *v1alpha1.Certificate, bool) (*certificate.Resource, error) {
+		return nil, injerr.NotReady("account of issuer acme")
+	}
+
+	res, err := r.Reconcile(ctx, request("default", "app"))
+	a.NoError(err)
+	a.Equal(afterIssuerNotReady5Min, res.RequeueAfter)
+	ready := meta.FindStatusCondition(getCertificate(t, c).Status.Conditions, v1alpha1.CertificateConditionReady)
+	a.Equal(v1alpha1.CertificateReasonIssuerNotReady, ready.Reason)
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certificate
+
+import (
+	"context"
+	"os"
+
+	"github.com/onmetal/injector/api/v1alpha1"
+	"github.com/onmetal/injector/internal/issuer"
+	"github.com/onmetal/injector/internal/kubernetes"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// certificatesForSecret maps a secret to the certificate stored in it and the certificates whose signing request
+// or keystore password it stores, so deleted secrets are recreated, changed requests are issued and keystores
+// are regenerated.
+func (r *Reconciler) certificatesForSecret(obj client.Object) []reconcile.Request {
+	var requests []reconcile.Request
+	if name := obj.GetLabels()[kubernetes.CertificateNameLabelKey]; name != "" {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+			Namespace: obj.GetNamespace(),
+			Name:      name,
+		}})
+	}
+	certificates := &v1alpha1.CertificateList{}
+	if err := r.List(context.Background(), certificates, client.InNamespace(obj.GetNamespace())); err != nil {
+		return requests
+	}
+	for i := range certificates.Items {
+		crt := &certificates.Items[i]
+		if referencesSecret(crt, obj.GetName()) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(crt)})
+		}
+	}
+	return requests
+}
+
+// referencesSecret reports whether the certificate reads its signing request or a keystore password from the secret.
+func referencesSecret(crt *v1alpha1.Certificate, name string) bool {
+	if csr := crt.Spec.CSR; csr != nil && csr.SecretRef != nil && csr.SecretRef.Name == name {
+		return true
+	}
+	if ks := crt.Spec.Keystores; ks != nil {
+		for _, k := range []*v1alpha1.CertificateKeystore{ks.PKCS12, ks.JKS} {
+			if k != nil && k.PasswordSecretRef.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// certificatesForIssuer maps an issuer to the certificates which reference it.
+func (r *Reconciler) certificatesForIssuer(obj client.Object) []reconcile.Request {
+	kind := v1alpha1.IssuerKind
+	var opts []client.ListOption
+	if _, ok := obj.(*v1alpha1.ClusterIssuer); ok {
+		kind = v1alpha1.ClusterIssuerKind
+	} else {
+		opts = append(opts, client.InNamespace(obj.GetNamespace()))
+	}
+	certificates := &v1alpha1.CertificateList{}
+	if err := r.List(context.Background(), certificates, opts...); err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range certificates.Items {
+		crt := &certificates.Items[i]
+		if refKind, name := issuerOf(crt); refKind == kind && name == obj.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(crt)})
+		}
+	}
+	return requests
+}
+
+// issuerOf returns the kind and the name of the issuer of the certificate.
+func issuerOf(crt *v1alpha1.Certificate) (string, string) {
+	ref := crt.Spec.IssuerRef
+	if ref == nil {
+		return v1alpha1.ClusterIssuerKind, os.Getenv(issuer.DefaultIssuerEnv)
+	}
+	if ref.Kind == "" {
+		return v1alpha1.IssuerKind, ref.Name
+	}
+	return ref.Kind, ref.Name
+}
+
+// issuerBecameReady passes issuers whose account was registered, certificates waiting for them are retried.
+func issuerBecameReady() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool { return isIssuerReady(e.Object) },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return !isIssuerReady(e.ObjectOld) && isIssuerReady(e.ObjectNew)
+		},
+		DeleteFunc:  func(event.DeleteEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+}
+
+func isIssuerReady(obj client.Object) bool {
+	gi, ok := obj.(v1alpha1.GenericIssuer)
+	return ok && meta.IsStatusConditionTrue(gi.GetStatus().Conditions, v1alpha1.IssuerConditionReady)
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certificate
+
+import (
+	"testing"
+
+	"github.com/onmetal/injector/api/v1alpha1"
+	"github.com/onmetal/injector/internal/issuer"
+	"github.com/onmetal/injector/internal/kubernetes"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func testReconciler(t *testing.T) *Reconciler {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	assert.NoError(t, clientgoscheme.AddToScheme(scheme))
+	assert.NoError(t, v1alpha1.AddToScheme(scheme))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&v1alpha1.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+			Spec: v1alpha1.CertificateSpec{
+				IssuerRef: &v1alpha1.IssuerReference{Name: "acme"},
+				CSR:       &v1alpha1.CertificateSigningRequest{SecretRef: &v1alpha1.SecretKeySelector{Name: "hsm-csr"}},
+			},
+		},
+		&v1alpha1.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec: v1alpha1.CertificateSpec{Keystores: &v1alpha1.CertificateKeystores{
+				JKS: &v1alpha1.CertificateKeystore{PasswordSecretRef: v1alpha1.SecretKeySelector{Name: "keystore"}},
+			}},
+		},
+		&v1alpha1.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "other"},
+			Spec:       v1alpha1.CertificateSpec{IssuerRef: &v1alpha1.IssuerReference{Name: "acme", Kind: v1alpha1.ClusterIssuerKind}},
+		},
+	).Build()
+	return &Reconciler{Client: c, Scheme: scheme}
+}
+
+func request(namespace, name string) reconcile.Request {
+	return reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: name}}
+}
+
+func TestCertificatesForSecret(t *testing.T) {
+	a := assert.New(t)
+	r := testReconciler(t)
+	a.Equal([]reconcile.Request{request("default", "web")}, r.certificatesForSecret(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Name: "web-tls", Namespace: "default", Labels: map[string]string{kubernetes.CertificateNameLabelKey: "web"},
+	}}))
+	a.Equal([]reconcile.Request{request("default", "app")}, r.certificatesForSecret(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Name: "hsm-csr", Namespace: "default",
+	}}))
+	a.Equal([]reconcile.Request{request("default", "web")}, r.certificatesForSecret(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Name: "keystore", Namespace: "default",
+	}}))
+	a.Empty(r.certificatesForSecret(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "hsm-csr", Namespace: "other"}}))
+}
+
+func TestCertificatesForIssuer(t *testing.T) {
+	a := assert.New(t)
+	r := testReconciler(t)
+	a.Equal([]reconcile.Request{request("default", "app")}, r.certificatesForIssuer(&v1alpha1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "acme", Namespace: "default"},
+	}))
+	a.Equal([]reconcile.Request{request("other", "api")}, r.certificatesForIssuer(&v1alpha1.ClusterIssuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "acme"},
+	}))
+
+	t.Setenv(issuer.DefaultIssuerEnv, "letsencrypt")
+	a.Equal([]reconcile.Request{request("default", "web")}, r.certificatesForIssuer(&v1alpha1.ClusterIssuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "letsencrypt"},
+	}))
+}
+
+func TestIssuerBecameReady(t *testing.T) {
+	a := assert.New(t)
+	p := issuerBecameReady()
+	pending := &v1alpha1.Issuer{}
+	ready := &v1alpha1.Issuer{Status: v1alpha1.IssuerStatus{Conditions: []metav1.Condition{{
+		Type: v1alpha1.IssuerConditionReady, Status: metav1.ConditionTrue,
+	}}}}
+	a.True(p.Update(event.UpdateEvent{ObjectOld: pending, ObjectNew: ready}))
+	a.False(p.Update(event.UpdateEvent{ObjectOld: ready, ObjectNew: ready}))
+	a.False(p.Update(event.UpdateEvent{ObjectOld: ready, ObjectNew: pending}))
+	a.True(p.Create(event.CreateEvent{Object: ready}))
+}
@@ -20,18 +20,22 @@ import (
 	"context"
 	"time"
 
+	"github.com/onmetal/injector/api/v1alpha1"
 	injerr "github.com/onmetal/injector/internal/errors"
 	"github.com/onmetal/injector/internal/issuer"
-	"github.com/onmetal/injector/internal/kubernetes"
-	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
 
-const afterRateLimit7Days = 168 * time.Hour
+const afterFailure1Hour = time.Hour
 
+// Reconciler registers the ACME account of an Issuer.
 type Reconciler struct {
 	client.Client
 
@@ -41,60 +45,85 @@ type Reconciler struct {
 // SetupWithManager sets up the controller with the Manager.
 func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&corev1.Service{}).
+		For(&v1alpha1.Issuer{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		Complete(r)
 }
 
-//+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;update;patch
-//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=cert.injector.ko,resources=issuers,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cert.injector.ko,resources=issuers/status,verbs=get;update;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
 func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	iss := &v1alpha1.Issuer{}
+	if err := r.Get(ctx, req.NamespacedName, iss); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	return reconcileIssuer(ctx, r.Client, iss)
+}
+
+// ClusterReconciler registers the ACME account of a ClusterIssuer.
+type ClusterReconciler struct {
+	client.Client
+
+	Scheme *runtime.Scheme
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.ClusterIssuer{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
+
+//+kubebuilder:rbac:groups=cert.injector.ko,resources=clusterissuers,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cert.injector.ko,resources=clusterissuers/status,verbs=get;update;patch
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+func (r *ClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	iss := &v1alpha1.ClusterIssuer{}
+	if err := r.Get(ctx, req.NamespacedName, iss); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	return reconcileIssuer(ctx, r.Client, iss)
+}
+
+func reconcileIssuer(ctx context.Context, c client.Client, gi v1alpha1.GenericIssuer) (ctrl.Result, error) {
 	reqLog := log.FromContext(ctx)
 
-	i, err := issuer.New(ctx, r.Client, reqLog, req)
+	status := gi.GetStatus()
+	account, err := issuer.Register(ctx, c, gi)
 	if err != nil {
-		if injerr.IsNotRequired(err) {
-			reqLog.Info("reconciliation finished")
-			return ctrl.Result{}, nil
+		reqLog.Info("can't register account", "error", err)
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               v1alpha1.IssuerConditionReady,
+			Status:             metav1.ConditionFalse,
+			Reason:             v1alpha1.IssuerReasonFailed,
+			Message:            err.Error(),
+			ObservedGeneration: gi.GetGeneration(),
+		})
+		if statusErr := c.Status().Update(ctx, gi); statusErr != nil {
+			return ctrl.Result{}, statusErr
 		}
-		reqLog.Info("can't create issuer", "error", err)
-		return ctrl.Result{}, err
-	}
-	if solverErr := i.RegisterChallengeProvider(); solverErr != nil {
-		reqLog.Info("can't register http solver", "error", solverErr)
-		return ctrl.Result{}, solverErr
-	}
-	if regErr := i.RegisterAccount(); regErr != nil {
-		reqLog.Info("can't register client", "error", regErr)
-		return ctrl.Result{}, regErr
-	}
-	cert, err := i.Obtain()
-	if err != nil {
-		if injerr.IsRateLimited(err) {
-			reqLog.Info("can't obtain certificate", "error", err)
-			reqLog.Info("reconciliation finished")
-			return ctrl.Result{RequeueAfter: afterRateLimit7Days}, nil
+		requeueAfter := afterFailure1Hour
+		if acmeErr, ok := injerr.AsACME(err); ok && acmeErr.HasType(injerr.ACMEProblemRateLimited) {
+			if wait := time.Until(acmeErr.RetryAfter); wait > 0 {
+				requeueAfter = wait
+			}
 		}
-		reqLog.Info("can't obtain certificate", "error", err)
-		return ctrl.Result{}, nil
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
 	}
 
-	k8s, err := kubernetes.New(ctx, r.Client, reqLog, cert, req)
-	if err != nil {
-		reqLog.Info("can't create kubernetes client", "error", err)
-		return ctrl.Result{}, err
-	}
-	if err := k8s.CreateOrUpdateSecretForCertificate(); err != nil {
-		reqLog.Info("can't create secret for certificate", "error", err)
-		return ctrl.Result{}, err
-	}
-	if err := k8s.InjectCertIntoDeployment(); err != nil {
-		if injerr.IsNotRequired(err) {
-			reqLog.Info("reconciliation finished")
-			return ctrl.Result{}, nil
-		}
+	status.ACME = account
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               v1alpha1.IssuerConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             v1alpha1.IssuerReasonRegistered,
+		Message:            "ACME account is registered",
+		ObservedGeneration: gi.GetGeneration(),
+	})
+	if err := c.Status().Update(ctx, gi); err != nil {
 		return ctrl.Result{}, err
 	}
 	reqLog.Info("reconciliation finished")
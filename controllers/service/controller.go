@@ -0,0 +1,178 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/onmetal/injector/api/v1alpha1"
+	injerr "github.com/onmetal/injector/internal/errors"
+	"github.com/onmetal/injector/internal/kubernetes"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	issueAnnotationKey          = "cert.injector.ko/issue"
+	domainsAnnotationKey        = "cert.injector.ko/domains"
+	issuerAnnotationKey         = "cert.injector.ko/issuer"
+	issuerKindAnnotationKey     = "cert.injector.ko/issuer-kind"
+	autoInjectAnnotationKey     = "cert.injector.ko/auto-inject"
+	deploymentNameAnnotationKey = "cert.injector.ko/deployment-name"
+	secretNameAnnotationKey     = "cert.injector.ko/secret-name"
+	deleteSecretAnnotationKey   = "cert.injector.ko/delete-secret"
+)
+
+// Annotations of previous versions which configured the ACME server per service.
+const (
+	caURLAnnotationKey = "cert.injector.ko/ca-url"
+	emailAnnotationKey = "cert.injector.ko/email"
+)
+
+const (
+	issueEnabled = "true"
+	// issueDone is set by previous versions once the certificate has been issued.
+	issueDone = "done"
+)
+
+// Reconciler creates a Certificate for every Service annotated with cert.injector.ko/issue.
+type Reconciler struct {
+	client.Client
+
+	Scheme *runtime.Scheme
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Service{}).
+		Owns(&v1alpha1.Certificate{}).
+		Complete(r)
+}
+
+//+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=services/finalizers,verbs=update
+//+kubebuilder:rbac:groups=cert.injector.ko,resources=certificates,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	reqLog := log.FromContext(ctx)
+
+	svc, err := kubernetes.GetService(ctx, r.Client, req)
+	if err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !isRequired(svc.Annotations) {
+		if err := r.deleteCertificate(ctx, svc); err != nil {
+			reqLog.Info("can't delete certificate", "error", err)
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+	if _, ok := svc.Annotations[domainsAnnotationKey]; !ok {
+		reqLog.Info("can't create certificate", "error", injerr.NotExist("domain name"))
+		return ctrl.Result{}, nil
+	}
+	if isLegacyIssuer(svc.Annotations) {
+		reqLog.Info("ca-url and email annotations are ignored, reference an issuer instead", "annotation", issuerAnnotationKey)
+	}
+
+	crt := &v1alpha1.Certificate{ObjectMeta: metav1.ObjectMeta{Name: svc.Name, Namespace: svc.Namespace}}
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, crt, func() error {
+		if !crt.CreationTimestamp.IsZero() && !metav1.IsControlledBy(crt, svc) {
+			return injerr.AlreadyExist(fmt.Sprintf("certificate %s", crt.Name))
+		}
+		mutateCertificate(svc, crt)
+		return controllerutil.SetControllerReference(svc, crt, r.Scheme)
+	})
+	if err != nil {
+		if injerr.IsAlreadyExists(err) {
+			reqLog.Info("certificate is not managed by the service", "error", err)
+			return ctrl.Result{}, nil
+		}
+		reqLog.Info("can't create certificate", "error", err)
+		return ctrl.Result{}, err
+	}
+	reqLog.Info("reconciliation finished", "certificate", op)
+	return ctrl.Result{}, nil
+}
+
+// deleteCertificate deletes the certificate created for the service once the issue annotation is removed.
+func (r *Reconciler) deleteCertificate(ctx context.Context, svc *corev1.Service) error {
+	crt := &v1alpha1.Certificate{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}, crt); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(crt, svc) {
+		return nil
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, crt))
+}
+
+func isRequired(m map[string]string) bool {
+	v, ok := m[issueAnnotationKey]
+	return ok && (v == issueEnabled || v == issueDone)
+}
+
+func isLegacyIssuer(m map[string]string) bool {
+	_, caURL := m[caURLAnnotationKey]
+	_, email := m[emailAnnotationKey]
+	_, ref := m[issuerAnnotationKey]
+	return (caURL || email) && !ref
+}
+
+// mutateCertificate translates the legacy service annotations into the certificate spec.
+func mutateCertificate(svc *corev1.Service, crt *v1alpha1.Certificate) {
+	crt.Spec.Domains = splitDomains(svc.Annotations[domainsAnnotationKey])
+	crt.Spec.IssuerRef = nil
+	if name, ok := svc.Annotations[issuerAnnotationKey]; ok {
+		kind := svc.Annotations[issuerKindAnnotationKey]
+		if kind == "" {
+			kind = v1alpha1.IssuerKind
+		}
+		crt.Spec.IssuerRef = &v1alpha1.IssuerReference{Name: name, Kind: kind}
+	}
+	crt.Spec.SecretName = fmt.Sprintf("%s-tls", svc.Name)
+	if name := svc.Annotations[secretNameAnnotationKey]; name != "" {
+		crt.Spec.SecretName = name
+	}
+	crt.Spec.OwnSecret = svc.Annotations[deleteSecretAnnotationKey] == "true"
+	crt.Spec.ServiceName = svc.Name
+	crt.Spec.Targets = nil
+	if name, ok := svc.Annotations[deploymentNameAnnotationKey]; ok && svc.Annotations[autoInjectAnnotationKey] == "true" {
+		crt.Spec.Targets = []v1alpha1.WorkloadReference{{Kind: v1alpha1.WorkloadKindDeployment, Name: name}}
+	}
+}
+
+func splitDomains(s string) []string {
+	domains := make([]string, 0, strings.Count(s, ",")+1)
+	for _, d := range strings.Split(s, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/onmetal/injector/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestMutateCertificate(t *testing.T) {
+	a := assert.New(t)
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+		Name:      "injector",
+		Namespace: "default",
+		Annotations: map[string]string{
+			issueAnnotationKey:          "true",
+			domainsAnnotationKey:        "domain.com, zzz.domain.com,",
+			issuerAnnotationKey:         "letsencrypt",
+			autoInjectAnnotationKey:     "true",
+			deploymentNameAnnotationKey: "nginx",
+		},
+	}}
+	crt := &v1alpha1.Certificate{}
+	mutateCertificate(svc, crt)
+
+	a.Equal([]string{"domain.com", "zzz.domain.com"}, crt.Spec.Domains)
+	a.Equal("injector-tls", crt.Spec.SecretName)
+	a.Equal("injector", crt.Spec.ServiceName)
+	a.Equal([]v1alpha1.WorkloadReference{{Kind: v1alpha1.WorkloadKindDeployment, Name: "nginx"}}, crt.Spec.Targets)
+	a.Equal(&v1alpha1.IssuerReference{Name: "letsencrypt", Kind: v1alpha1.IssuerKind}, crt.Spec.IssuerRef)
+
+	delete(svc.Annotations, issuerAnnotationKey)
+	svc.Annotations[autoInjectAnnotationKey] = "false"
+	mutateCertificate(svc, crt)
+
+	a.Empty(crt.Spec.Targets)
+	a.Nil(crt.Spec.IssuerRef)
+	a.False(crt.Spec.OwnSecret)
+
+	svc.Annotations[secretNameAnnotationKey] = "custom-tls"
+	svc.Annotations[deleteSecretAnnotationKey] = "true"
+	mutateCertificate(svc, crt)
+
+	a.Equal("custom-tls", crt.Spec.SecretName)
+	a.True(crt.Spec.OwnSecret)
+}
+
+func TestDeleteCertificate(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	a.NoError(clientgoscheme.AddToScheme(scheme))
+	a.NoError(v1alpha1.AddToScheme(scheme))
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+		Name:        "injector",
+		Namespace:   "default",
+		UID:         "1234",
+		Annotations: map[string]string{issueAnnotationKey: "true", domainsAnnotationKey: "domain.com"},
+	}}
+	other := &v1alpha1.Certificate{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(svc, other).Build()
+	r := &Reconciler{Client: c, Scheme: scheme}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "injector"}}
+	_, err := r.Reconcile(ctx, req)
+	a.NoError(err)
+	crt := &v1alpha1.Certificate{}
+	a.NoError(c.Get(ctx, req.NamespacedName, crt))
+
+	delete(svc.Annotations, issueAnnotationKey)
+	a.NoError(c.Update(ctx, svc))
+	_, err = r.Reconcile(ctx, req)
+	a.NoError(err)
+	a.True(apierr.IsNotFound(c.Get(ctx, req.NamespacedName, crt)), "the certificate is deleted without the issue annotation")
+
+	// certificates which aren't controlled by the service are kept
+	svc.Name = "other"
+	svc.ResourceVersion = ""
+	a.NoError(c.Create(ctx, svc))
+	_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "other"}})
+	a.NoError(err)
+	a.NoError(c.Get(ctx, client.ObjectKeyFromObject(other), crt))
+}
@@ -0,0 +1,201 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package errors
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-acme/lego/v4/acme"
+)
+
+const acmeProblemNamespace = "urn:ietf:params:acme:error:"
+
+// Problem types of ACME servers, see RFC 8555 section 6.7.
+const (
+	ACMEProblemRateLimited           = "rateLimited"
+	ACMEProblemBadNonce              = "badNonce"
+	ACMEProblemUnauthorized          = "unauthorized"
+	ACMEProblemDNS                   = "dns"
+	ACMEProblemConnection            = "connection"
+	ACMEProblemCAA                   = "caa"
+	ACMEProblemTLS                   = "tls"
+	ACMEProblemIncorrectResponse     = "incorrectResponse"
+	ACMEProblemRejectedIdentifier    = "rejectedIdentifier"
+	ACMEProblemUnsupportedIdentifier = "unsupportedIdentifier"
+	ACMEProblemMalformed             = "malformed"
+	ACMEProblemBadCSR                = "badCSR"
+	ACMEProblemServerInternal        = "serverInternal"
+	ACMEProblemAccountDoesNotExist   = "accountDoesNotExist"
+	ACMEProblemExternalAccount       = "externalAccountRequired"
+	ACMEProblemUserActionRequired    = "userActionRequired"
+)
+
+// ACMESubProblem is a problem of a single identifier of an ACME problem document.
+type ACMESubProblem struct {
+	Type       string
+	Detail     string
+	Identifier string
+}
+
+// ACMEError is a problem document returned by the ACME server.
+type ACMEError struct {
+	// Type of the problem without the urn:ietf:params:acme:error: namespace.
+	Type   string
+	Detail string
+	// Domain the problem occurred for, if it's specific to a domain.
+	Domain     string
+	HTTPStatus int
+	// RetryAfter is the time after which the request may be retried, zero if the server didn't tell.
+	RetryAfter  time.Time
+	SubProblems []ACMESubProblem
+
+	err error
+}
+
+func (e *ACMEError) Error() string { return e.err.Error() }
+
+func (e *ACMEError) Unwrap() error { return e.err }
+
+// HasType returns whether the problem or one of its subproblems is of the type.
+func (e *ACMEError) HasType(problemType string) bool {
+	if e.Type == problemType {
+		return true
+	}
+	for _, sp := range e.SubProblems {
+		if sp.Type == problemType {
+			return true
+		}
+	}
+	return false
+}
+
+// retryAfterError is an error of a request to the ACME server which was rate limited until a time.
+type retryAfterError struct {
+	err        error
+	retryAfter time.Time
+}
+
+func (e *retryAfterError) Error() string { return e.err.Error() }
+
+func (e *retryAfterError) Unwrap() error { return e.err }
+
+// WithRetryAfter adds the time given by the Retry-After header of a rate limited response to the error,
+// lego returns the problem document of the response without its headers.
+func WithRetryAfter(err error, retryAfter time.Time) error {
+	if err == nil || retryAfter.IsZero() {
+		return err
+	}
+	return &retryAfterError{err: err, retryAfter: retryAfter}
+}
+
+// AsACME converts an error returned by lego into an ACMEError.
+// If several domains failed, the rate limit problem or the problem of the first domain is returned.
+func AsACME(err error) (*ACMEError, bool) {
+	if err == nil {
+		return nil, false
+	}
+	var acmeErr *ACMEError
+	if errors.As(err, &acmeErr) {
+		return acmeErr, true
+	}
+	legoErr := err
+	var retryErr *retryAfterError
+	if errors.As(err, &retryErr) {
+		legoErr = retryErr.err
+	}
+	problems := acmeProblems(legoErr, "")
+	if len(problems) == 0 {
+		return nil, false
+	}
+	for _, p := range problems {
+		if p.HasType(ACMEProblemRateLimited) {
+			p.err = err
+			if retryErr != nil {
+				p.RetryAfter = retryErr.retryAfter
+			}
+			return p, true
+		}
+	}
+	problems[0].err = err
+	return problems[0], true
+}
+
+// IsACMEProblem returns whether the error is an ACME problem of the type.
+func IsACMEProblem(err error, problemType string) bool {
+	acmeErr, ok := AsACME(err)
+	return ok && acmeErr.HasType(problemType)
+}
+
+func acmeProblems(err error, domain string) []*ACMEError {
+	if domains, errs, ok := domainErrors(err); ok {
+		var problems []*ACMEError
+		for i, domainErr := range errs {
+			problems = append(problems, acmeProblems(domainErr, domains[i])...)
+		}
+		return problems
+	}
+
+	var pd *acme.ProblemDetails
+	var nonceErr *acme.NonceError
+	switch {
+	case errors.As(err, &nonceErr):
+		pd = nonceErr.ProblemDetails
+	case errors.As(err, &pd):
+	default:
+		return nil
+	}
+	return []*ACMEError{newACMEError(pd, domain, err)}
+}
+
+// domainErrors returns the errors of the domains sorted by domain, if the error collects them.
+// lego collects the errors of several domains in maps of its internal error types.
+func domainErrors(err error) ([]string, []error, bool) {
+	v := reflect.ValueOf(err)
+	if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+		return nil, nil, false
+	}
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	domains := make([]string, 0, len(keys))
+	errs := make([]error, 0, len(keys))
+	for _, k := range keys {
+		if domainErr, ok := v.MapIndex(k).Interface().(error); ok {
+			domains = append(domains, k.String())
+			errs = append(errs, domainErr)
+		}
+	}
+	return domains, errs, true
+}
+
+func newACMEError(pd *acme.ProblemDetails, domain string, err error) *ACMEError {
+	e := &ACMEError{
+		Type:       strings.TrimPrefix(pd.Type, acmeProblemNamespace),
+		Detail:     pd.Detail,
+		Domain:     domain,
+		HTTPStatus: pd.HTTPStatus,
+		err:        err,
+	}
+	for _, sp := range pd.SubProblems {
+		e.SubProblems = append(e.SubProblems, ACMESubProblem{
+			Type:       strings.TrimPrefix(sp.Type, acmeProblemNamespace),
+			Detail:     sp.Detail,
+			Identifier: sp.Identifier.Value,
+		})
+	}
+	return e
+}
@@ -0,0 +1,82 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-acme/lego/v4/acme"
+	"github.com/stretchr/testify/assert"
+)
+
+// domainErrors mimics the error type lego returns if several domains failed.
+type obtainErrors map[string]error
+
+func (e obtainErrors) Error() string { return "error: one or more domains had a problem" }
+
+func TestAsACME(t *testing.T) {
+	a := assert.New(t)
+	rateLimited := &acme.ProblemDetails{
+		Type:       "urn:ietf:params:acme:error:rateLimited",
+		HTTPStatus: 429,
+		Detail: "too many certificates (5) already issued for this exact set of domains in the last 168h0m0s, " +
+			"retry after 2022-08-01 10:11:12 UTC: see https://letsencrypt.org/docs/duplicate-certificate-limit/",
+	}
+	unauthorized := &acme.ProblemDetails{
+		Type:       "urn:ietf:params:acme:error:unauthorized",
+		HTTPStatus: 403,
+		Detail:     "Invalid response from http://b.domain.com/.well-known/acme-challenge/token: 404",
+	}
+
+	acmeErr, ok := AsACME(fmt.Errorf("can't obtain: %w", rateLimited))
+	a.True(ok)
+	a.Equal(ACMEProblemRateLimited, acmeErr.Type)
+	a.True(acmeErr.RetryAfter.IsZero(), "the detail isn't parsed for a retry hint")
+	a.True(IsRateLimited(acmeErr))
+
+	retryAfter := time.Date(2022, 8, 1, 10, 11, 12, 0, time.UTC)
+	err := obtainErrors{"a.domain.com": unauthorized, "b.domain.com": fmt.Errorf("acme: %w", rateLimited)}
+	acmeErr, ok = AsACME(WithRetryAfter(err, retryAfter))
+	a.True(ok)
+	a.Equal(ACMEProblemRateLimited, acmeErr.Type)
+	a.Equal("b.domain.com", acmeErr.Domain)
+	a.Equal(retryAfter, acmeErr.RetryAfter)
+	a.Equal(err.Error(), acmeErr.Error())
+
+	acmeErr, ok = AsACME(obtainErrors{"b.domain.com": unauthorized})
+	a.True(ok)
+	a.Equal(ACMEProblemUnauthorized, acmeErr.Type)
+	a.True(acmeErr.RetryAfter.IsZero())
+
+	acmeErr, ok = AsACME(&acme.NonceError{ProblemDetails: &acme.ProblemDetails{Type: acme.BadNonceErr}})
+	a.True(ok)
+	a.Equal(ACMEProblemBadNonce, acmeErr.Type)
+
+	a.True(IsACMEProblem(&acme.ProblemDetails{
+		Type:        "urn:ietf:params:acme:error:compound",
+		SubProblems: []acme.SubProblem{{Type: "urn:ietf:params:acme:error:caa"}},
+	}, ACMEProblemCAA))
+
+	_, ok = AsACME(errors.New("connection refused"))
+	a.False(ok)
+	a.False(IsRateLimited(errors.New("rateLimited")))
+}
+
+func TestReasonForDomainErrors(t *testing.T) {
+	err := obtainErrors{"a.domain.com": fmt.Errorf("acme: error presenting token: %w", SelfCheckFailed("404"))}
+	assert.True(t, IsSelfCheckFailed(err))
+}
@@ -16,7 +16,6 @@ package errors
 import (
 	"errors"
 	"fmt"
-	"strings"
 )
 
 const (
@@ -24,6 +23,8 @@ const (
 	StatusReasonNotExist     StatusReason = "not exist"
 	StatusReasonNotRequired  StatusReason = "not required"
 	StatusReasonNotFound     StatusReason = "not found"
+	StatusReasonSelfCheck    StatusReason = "self check failed"
+	StatusReasonNotReady     StatusReason = "not ready"
 	StatusReasonUnknown      StatusReason = "unknown"
 )
 
@@ -54,12 +55,23 @@ func IsNotRequired(err error) bool { return ReasonForError(err) == StatusReasonN
 
 func IsNotFound(err error) bool { return ReasonForError(err) == StatusReasonNotFound }
 
-func IsRateLimited(err error) bool { return strings.Contains(err.Error(), "rateLimited") }
+func IsSelfCheckFailed(err error) bool { return ReasonForError(err) == StatusReasonSelfCheck }
+
+func IsNotReady(err error) bool { return ReasonForError(err) == StatusReasonNotReady }
+
+func IsRateLimited(err error) bool { return IsACMEProblem(err, ACMEProblemRateLimited) }
 
 func ReasonForError(err error) StatusReason {
 	if reason := IStatus(nil); errors.As(err, &reason) {
 		return reason.Status().StatusReason
 	}
+	if _, errs, ok := domainErrors(err); ok {
+		for _, domainErr := range errs {
+			if reason := ReasonForError(domainErr); reason != StatusReasonUnknown {
+				return reason
+			}
+		}
+	}
 	return StatusReasonUnknown
 }
 
@@ -98,3 +110,21 @@ func NotFound() *Error {
 		},
 	}
 }
+
+func SelfCheckFailed(s string) *Error {
+	return &Error{
+		ErrStatus: Reason{
+			Message:      fmt.Sprintf("self check failed: %s", s),
+			StatusReason: StatusReasonSelfCheck,
+		},
+	}
+}
+
+func NotReady(s string) *Error {
+	return &Error{
+		ErrStatus: Reason{
+			Message:      fmt.Sprintf("name: %s, not ready", s),
+			StatusReason: StatusReasonNotReady,
+		},
+	}
+}
@@ -14,45 +14,168 @@ limitations under the License.
 package issuer
 
 import (
-	"strings"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
 
-	"github.com/onmetal/injector/internal/issuer/solver"
+	"github.com/onmetal/injector/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-acme/lego/v4/lego"
 	"github.com/go-acme/lego/v4/registration"
 	injerr "github.com/onmetal/injector/internal/errors"
+	"github.com/onmetal/injector/internal/kubernetes"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
 )
 
-const domainsAnnotationKey = "cert.injector.ko/domains"
+// Keys of the external account binding credentials in their secret.
+const (
+	EABKeyIDKey   = "keyID"
+	EABHMACKeyKey = "hmacKey"
+)
 
 func (c *certs) RegisterChallengeProvider() error {
-	s := solver.New(c.ctx, c.k8sClient, c.log, c.svc)
-	return c.legoClient.Challenge.SetHTTP01Provider(s)
+	return RegisterChallengeProvider(c.ctx, c.k8sClient, c.log, c.legoClient, c.crt, c.gi)
+}
+
+// Register registers the ACME account of the issuer or resolves the existing one and returns the status of the
+// account. An account stored in the status of the issuer is resolved by its key, it's registered again only if
+// the ACME server doesn't know it.
+func Register(ctx context.Context, c client.Client, gi v1alpha1.GenericIssuer) (*v1alpha1.ACMEIssuerStatus, error) {
+	acme := gi.GetSpec().ACME
+	privateKey, err := GetPrivateKey(ctx, c, gi)
+	if err != nil {
+		return nil, err
+	}
+	thumbprint, err := KeyThumbprint(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	config, err := NewConfig(NewUser(acme.Email, privateKey), acme)
+	if err != nil {
+		return nil, err
+	}
+	legoClient, err := lego.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	reg, err := resolveOrRegister(ctx, c, legoClient, gi, privateKey)
+	if err != nil {
+		return nil, WithRetryAfter(config, err)
+	}
+	return &v1alpha1.ACMEIssuerStatus{
+		URI:                 reg.URI,
+		LastRegisteredEmail: acme.Email,
+		Server:              acme.Server,
+		KeyThumbprint:       thumbprint,
+	}, nil
+}
+
+func resolveOrRegister(ctx context.Context, c client.Client, legoClient *lego.Client, gi v1alpha1.GenericIssuer,
+	privateKey crypto.Signer) (*registration.Resource, error) {
+	if AccountRegistration(gi, privateKey) != nil {
+		reg, err := legoClient.Registration.ResolveAccountByKey()
+		if err == nil {
+			return reg, nil
+		}
+		// external account bindings can be used once, transient errors mustn't register the account again
+		if !injerr.IsACMEProblem(err, injerr.ACMEProblemAccountDoesNotExist) {
+			return nil, err
+		}
+	}
+	return register(ctx, c, legoClient, gi)
+}
+
+// AccountRegistration returns the account stored in the status of the issuer, nil if it isn't registered yet
+// or the email, the ACME server or the account key were changed since.
+func AccountRegistration(gi v1alpha1.GenericIssuer, privateKey crypto.Signer) *registration.Resource {
+	acme, status := gi.GetSpec().ACME, gi.GetStatus().ACME
+	if status == nil || status.URI == "" || status.LastRegisteredEmail != acme.Email || status.Server != acme.Server {
+		return nil
+	}
+	if thumbprint, err := KeyThumbprint(privateKey); err != nil || thumbprint != status.KeyThumbprint {
+		return nil
+	}
+	return &registration.Resource{URI: status.URI}
+}
+
+// KeyThumbprint returns the hex encoded SHA-256 hash of the public key of the private key.
+func KeyThumbprint(privateKey crypto.Signer) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func register(ctx context.Context, c client.Client, legoClient *lego.Client, gi v1alpha1.GenericIssuer) (*registration.Resource, error) {
+	acme := gi.GetSpec().ACME
+	if !acme.TermsOfServiceAgreed {
+		return nil, fmt.Errorf("terms of service of %s are not agreed", acme.Server)
+	}
+	if acme.ExternalAccountBinding == nil {
+		return legoClient.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
+	}
+	opts, err := externalAccountBinding(ctx, c, gi)
+	if err != nil {
+		return nil, err
+	}
+	return legoClient.Registration.RegisterWithExternalAccountBinding(opts)
 }
 
-func (c *certs) RegisterAccount() error {
-	reg, err := c.legoClient.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
+// externalAccountBinding returns the registration options with the external account binding credentials of the issuer.
+func externalAccountBinding(ctx context.Context, c client.Client, gi v1alpha1.GenericIssuer) (registration.RegisterEABOptions, error) {
+	name := gi.GetSpec().ACME.ExternalAccountBinding.SecretName
+	secret, err := kubernetes.GetSecret(ctx, c, ctrl.Request{NamespacedName: types.NamespacedName{
+		Namespace: ResourceNamespace(gi),
+		Name:      name,
+	}})
 	if err != nil {
-		c.log.Info("can't register new user, %s", "error", err)
-		return err
+		return registration.RegisterEABOptions{}, err
 	}
-	c.User.Registration = reg
-	return err
+	keyID, hmacKey := secret.Data[EABKeyIDKey], secret.Data[EABHMACKeyKey]
+	if len(keyID) == 0 || len(hmacKey) == 0 {
+		return registration.RegisterEABOptions{}, fmt.Errorf("external account binding secret %s must contain %s and %s",
+			name, EABKeyIDKey, EABHMACKeyKey)
+	}
+	return registration.RegisterEABOptions{
+		TermsOfServiceAgreed: true,
+		Kid:                  string(keyID),
+		HmacEncoded:          string(hmacKey),
+	}, nil
 }
 
 func (c *certs) Obtain() (*certificate.Resource, error) {
-	d, ok := c.svc.Annotations[domainsAnnotationKey]
-	if !ok {
+	if len(c.crt.Spec.Domains) == 0 {
 		return nil, injerr.NotExist("domain name")
 	}
-	domains := strings.Split(d, ",")
-	request := certificate.ObtainRequest{
-		Domains: domains,
-		Bundle:  true,
+	if c.crt.Spec.CSR != nil {
+		cert, err := ObtainForRequest(c.ctx, c.k8sClient, c.legoClient, c.crt)
+		return cert, WithRetryAfter(c.config, err)
 	}
-	return c.legoClient.Certificate.Obtain(request)
+	key, err := GeneratePrivateKey(c.crt)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := ObtainWithPrivateKey(c.legoClient, c.crt, key)
+	return cert, WithRetryAfter(c.config, err)
 }
 
 func (c *certs) Renew() (*certificate.Resource, error) {
-	return c.legoClient.Certificate.Renew(*c.cert, true, true, "")
+	if c.crt.Spec.CSR != nil {
+		cert, err := ObtainForRequest(c.ctx, c.k8sClient, c.legoClient, c.crt)
+		return cert, WithRetryAfter(c.config, err)
+	}
+	key, err := RenewalPrivateKey(c.crt, c.cert.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := ObtainWithPrivateKey(c.legoClient, c.crt, key)
+	return cert, WithRetryAfter(c.config, err)
 }
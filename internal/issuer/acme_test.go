@@ -0,0 +1,204 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package issuer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-acme/lego/v4/registration"
+	"github.com/go-logr/logr"
+	"github.com/onmetal/injector/api/v1alpha1"
+	injerr "github.com/onmetal/injector/internal/errors"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestExternalAccountBinding(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	c := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "eab", Namespace: "default"},
+		Data:       map[string][]byte{EABKeyIDKey: []byte("kid-1"), EABHMACKeyKey: []byte("aG1hYw")},
+	}, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "incomplete", Namespace: "default"},
+		Data:       map[string][]byte{EABKeyIDKey: []byte("kid-1")},
+	}).Build()
+	iss := &v1alpha1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "zerossl", Namespace: "default"},
+		Spec: v1alpha1.IssuerSpec{ACME: &v1alpha1.ACMEIssuer{
+			Server:                 "https://acme.zerossl.com/v2/DV90",
+			ExternalAccountBinding: &v1alpha1.ACMEExternalAccountBinding{SecretName: "eab"},
+		}},
+	}
+	opts, err := externalAccountBinding(ctx, c, iss)
+	a.NoError(err)
+	a.Equal(registration.RegisterEABOptions{TermsOfServiceAgreed: true, Kid: "kid-1", HmacEncoded: "aG1hYw"}, opts)
+
+	iss.Spec.ACME.ExternalAccountBinding.SecretName = "incomplete"
+	_, err = externalAccountBinding(ctx, c, iss)
+	a.EqualError(err, "external account binding secret incomplete must contain keyID and hmacKey")
+}
+
+func TestAccountRegistration(t *testing.T) {
+	a := assert.New(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.NoError(err)
+	thumbprint, err := KeyThumbprint(key)
+	a.NoError(err)
+	iss := &v1alpha1.ClusterIssuer{Spec: v1alpha1.IssuerSpec{ACME: &v1alpha1.ACMEIssuer{
+		Server: "https://acme.example.com/directory",
+		Email:  "admin@example.com",
+	}}}
+	a.Nil(AccountRegistration(iss, key))
+
+	iss.Status.ACME = &v1alpha1.ACMEIssuerStatus{
+		URI:                 "https://acme.example.com/acct/1",
+		LastRegisteredEmail: "admin@example.com",
+		Server:              "https://acme.example.com/directory",
+		KeyThumbprint:       thumbprint,
+	}
+	a.Equal(&registration.Resource{URI: "https://acme.example.com/acct/1"}, AccountRegistration(iss, key))
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.NoError(err)
+	a.Nil(AccountRegistration(iss, other), "the account is registered again for a changed key")
+
+	iss.Spec.ACME.Server = "https://acme.other.com/directory"
+	a.Nil(AccountRegistration(iss, key), "the account is registered again for a changed server")
+
+	iss.Spec.ACME.Server = "https://acme.example.com/directory"
+	iss.Spec.ACME.Email = "ops@example.com"
+	a.Nil(AccountRegistration(iss, key), "the account is registered again for a changed email")
+}
+
+func TestNewRequiresAccount(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	a.NoError(clientgoscheme.AddToScheme(scheme))
+	a.NoError(v1alpha1.AddToScheme(scheme))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&v1alpha1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "acme", Namespace: "default"},
+		Spec: v1alpha1.IssuerSpec{ACME: &v1alpha1.ACMEIssuer{
+			Server:              "https://acme.example.com/directory",
+			Email:               "admin@example.com",
+			PrivateKeySecretRef: v1alpha1.SecretKeySelector{Name: "acme-account"},
+		}},
+	}).Build()
+	crt := &v1alpha1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec:       v1alpha1.CertificateSpec{IssuerRef: &v1alpha1.IssuerReference{Name: "acme"}},
+	}
+	_, err := New(ctx, c, logr.Discard(), crt)
+	a.True(injerr.IsNotReady(err), "certificates don't register the account of the issuer")
+}
+
+// acmeAccountServer is an ACME server which answers account lookups with the problem
+// and registers new accounts.
+type acmeAccountServer struct {
+	*httptest.Server
+	lookupProblem string
+	lookupStatus  int
+	registrations int
+}
+
+func newACMEAccountServer() *acmeAccountServer {
+	s := &acmeAccountServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/directory", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"newNonce":   s.URL + "/nonce",
+			"newAccount": s.URL + "/account",
+			"newOrder":   s.URL + "/order",
+			"revokeCert": s.URL + "/revoke",
+			"keyChange":  s.URL + "/key-change",
+		})
+	})
+	mux.HandleFunc("/nonce", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "nonce")
+	})
+	mux.HandleFunc("/account", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "nonce")
+		var jws struct {
+			Payload string `json:"payload"`
+		}
+		var account struct {
+			OnlyReturnExisting bool `json:"onlyReturnExisting"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&jws)
+		payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+		_ = json.Unmarshal(payload, &account)
+		if account.OnlyReturnExisting && s.lookupProblem != "" {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(s.lookupStatus)
+			_, _ = fmt.Fprintf(w, `{"type": "urn:ietf:params:acme:error:%s", "status": %d}`, s.lookupProblem, s.lookupStatus)
+			return
+		}
+		if !account.OnlyReturnExisting {
+			s.registrations++
+		}
+		w.Header().Set("Location", s.URL+"/acct/1")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"status": "valid"}`))
+	})
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func TestRegister(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	server := newACMEAccountServer()
+	defer server.Close()
+	c := fake.NewClientBuilder().Build()
+	iss := &v1alpha1.Issuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "acme", Namespace: "default"},
+		Spec: v1alpha1.IssuerSpec{ACME: &v1alpha1.ACMEIssuer{
+			Server:               server.URL + "/directory",
+			Email:                "admin@example.com",
+			TermsOfServiceAgreed: true,
+			PrivateKeySecretRef:  v1alpha1.SecretKeySelector{Name: "acme-account"},
+		}},
+	}
+	account, err := Register(ctx, c, iss)
+	a.NoError(err)
+	a.Equal(server.URL+"/acct/1", account.URI)
+	a.Equal(server.URL+"/directory", account.Server)
+	a.NotEmpty(account.KeyThumbprint)
+	a.Equal(1, server.registrations)
+	iss.Status.ACME = account
+
+	server.lookupProblem, server.lookupStatus = "serverInternal", http.StatusInternalServerError
+	_, err = Register(ctx, c, iss)
+	a.Error(err)
+	a.Equal(1, server.registrations, "transient errors don't register the account again")
+
+	server.lookupProblem, server.lookupStatus = "accountDoesNotExist", http.StatusBadRequest
+	_, err = Register(ctx, c, iss)
+	a.NoError(err)
+	a.Equal(2, server.registrations)
+}
@@ -0,0 +1,76 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package issuer
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-acme/lego/v4/lego"
+	"github.com/go-logr/logr"
+	"github.com/onmetal/injector/api/v1alpha1"
+	"github.com/onmetal/injector/internal/issuer/solver"
+	"github.com/onmetal/injector/internal/issuer/solver/dns01"
+	"github.com/onmetal/injector/internal/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const defaultTLSALPN01Port = 443
+
+// RegisterChallengeProvider registers the challenge solver configured by the issuer with the lego client.
+// The resolver pod behind the certificate's service solves HTTP-01 challenges unless the issuer configures
+// another challenge type.
+func RegisterChallengeProvider(ctx context.Context, c client.Client, l logr.Logger,
+	legoClient *lego.Client, crt *v1alpha1.Certificate, gi v1alpha1.GenericIssuer) error {
+	s := gi.GetSpec().ACME.Solver
+	if s == nil {
+		s = &v1alpha1.ACMESolver{}
+	}
+	if countSet(s.HTTP01 != nil, s.DNS01 != nil, s.TLSALPN01 != nil) > 1 {
+		return errors.New("solver has to configure at most one challenge type")
+	}
+	if h := s.HTTP01; h != nil && h.Mode == v1alpha1.SolverModeHTTPRoute && h.HTTPRoute == nil {
+		return errors.New("http01 solver in HTTPRoute mode has to configure httpRoute")
+	}
+	if s.DNS01 != nil {
+		p, err := dns01.New(ctx, c, ResourceNamespace(gi), s.DNS01)
+		if err != nil {
+			return err
+		}
+		return legoClient.Challenge.SetDNS01Provider(p, dns01.ChallengeOptions(s.DNS01)...)
+	}
+
+	svc, err := kubernetes.GetCertificateService(ctx, c, crt)
+	if err != nil {
+		return err
+	}
+	if s.TLSALPN01 != nil {
+		port := s.TLSALPN01.Port
+		if port == 0 {
+			port = defaultTLSALPN01Port
+		}
+		return legoClient.Challenge.SetTLSALPN01Provider(solver.NewTLSALPN(ctx, c, l, svc, port, s.PodTemplate))
+	}
+	return legoClient.Challenge.SetHTTP01Provider(solver.New(ctx, c, l, svc, s.HTTP01, s.PodTemplate))
+}
+
+func countSet(set ...bool) int {
+	n := 0
+	for _, ok := range set {
+		if ok {
+			n++
+		}
+	}
+	return n
+}
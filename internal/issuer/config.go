@@ -0,0 +1,189 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package issuer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/go-acme/lego/v4/lego"
+	"github.com/onmetal/injector/api/v1alpha1"
+	injerr "github.com/onmetal/injector/internal/errors"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ClusterResourceNamespaceEnv names the namespace secrets of cluster issuers are read from.
+	ClusterResourceNamespaceEnv = "CLUSTER_RESOURCE_NAMESPACE"
+	// DefaultIssuerEnv names the cluster issuer used by certificates without an issuer reference.
+	DefaultIssuerEnv = "DEFAULT_ISSUER"
+)
+
+const defaultClusterResourceNamespace = "default"
+
+// GetIssuer returns the issuer referenced by the certificate.
+func GetIssuer(ctx context.Context, c client.Client, crt *v1alpha1.Certificate) (v1alpha1.GenericIssuer, error) {
+	ref := crt.Spec.IssuerRef
+	if ref == nil {
+		name := os.Getenv(DefaultIssuerEnv)
+		if name == "" {
+			return nil, injerr.NotExist("issuer")
+		}
+		ref = &v1alpha1.IssuerReference{Name: name, Kind: v1alpha1.ClusterIssuerKind}
+	}
+
+	var gi v1alpha1.GenericIssuer
+	obj := types.NamespacedName{Name: ref.Name}
+	kind := ref.Kind
+	switch kind {
+	case v1alpha1.ClusterIssuerKind:
+		gi = &v1alpha1.ClusterIssuer{}
+	case v1alpha1.IssuerKind, "":
+		kind = v1alpha1.IssuerKind
+		gi = &v1alpha1.Issuer{}
+		obj.Namespace = crt.Namespace
+	default:
+		return nil, injerr.NotExist(fmt.Sprintf("issuer kind %s", kind))
+	}
+	if err := c.Get(ctx, obj, gi); err != nil {
+		if apierr.IsNotFound(err) {
+			return nil, injerr.NotExist(fmt.Sprintf("%s %s", kind, ref.Name))
+		}
+		return nil, err
+	}
+	if gi.GetSpec().ACME == nil {
+		return nil, injerr.NotExist(fmt.Sprintf("acme configuration of issuer %s", ref.Name))
+	}
+	return gi, nil
+}
+
+// ResourceNamespace returns the namespace secrets referenced by the issuer are read from.
+func ResourceNamespace(gi v1alpha1.GenericIssuer) string {
+	if gi.GetNamespace() != "" {
+		return gi.GetNamespace()
+	}
+	if ns := os.Getenv(ClusterResourceNamespaceEnv); ns != "" {
+		return ns
+	}
+	return defaultClusterResourceNamespace
+}
+
+// NewConfig returns the lego configuration for the user and the ACME server of an issuer.
+func NewConfig(u *User, acme *v1alpha1.ACMEIssuer) (*lego.Config, error) {
+	config := lego.NewConfig(u)
+	config.CADirURL = acme.Server
+	httpClient, err := NewHTTPClient(acme)
+	if err != nil {
+		return nil, err
+	}
+	transport := httpClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	httpClient.Transport = &rateLimitTransport{RoundTripper: transport}
+	config.HTTPClient = httpClient
+	return config, nil
+}
+
+// rateLimitTransport records the Retry-After header of rate limited responses of the ACME server,
+// lego returns the problem document of a response without its headers.
+type rateLimitTransport struct {
+	http.RoundTripper
+
+	mu         sync.Mutex
+	retryAfter time.Time
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		return resp, err
+	}
+	if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+		t.mu.Lock()
+		t.retryAfter = retryAfter
+		t.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// WithRetryAfter adds the time the ACME server asked to wait for with its last rate limited response
+// to the error of a request of the configuration.
+func WithRetryAfter(config *lego.Config, err error) error {
+	t, ok := config.HTTPClient.Transport.(*rateLimitTransport)
+	if !ok || err == nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return injerr.WithRetryAfter(err, t.retryAfter)
+}
+
+// parseRetryAfter parses the Retry-After header, which is either a delay in seconds or an HTTP date.
+func parseRetryAfter(header string, now time.Time) (time.Time, bool) {
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return now.Add(time.Duration(seconds) * time.Second), true
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// NewHTTPClient returns the HTTP client for the ACME server of an issuer, which trusts its CA bundle.
+func NewHTTPClient(acme *v1alpha1.ACMEIssuer) (*http.Client, error) {
+	httpClient := lego.NewConfig(nil).HTTPClient
+	if len(acme.CABundle) == 0 {
+		return httpClient, nil
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(acme.CABundle) {
+		return nil, fmt.Errorf("can't parse CA bundle of ACME server %s", acme.Server)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	return &http.Client{Timeout: httpClient.Timeout, Transport: transport}, nil
+}
+
+// CABundle returns the chain of the issuing CA of the certificate followed by the configured roots,
+// nil if the issuer doesn't store a CA bundle.
+func CABundle(acme *v1alpha1.ACMEIssuer, certPEM []byte) ([]byte, error) {
+	if acme.CA == nil {
+		return nil, nil
+	}
+	chain, err := certcrypto.ParsePEMBundle(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	var bundle []byte
+	// the first certificate is the leaf
+	for _, c := range chain[1:] {
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	return append(bundle, acme.CA.Roots...), nil
+}
@@ -0,0 +1,112 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package issuer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-acme/lego/v4/acme"
+	"github.com/onmetal/injector/api/v1alpha1"
+	injerr "github.com/onmetal/injector/internal/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCertificate(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	assert.NoError(t, err)
+	c, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return c, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestCABundle(t *testing.T) {
+	a := assert.New(t)
+	ca, caKey, caPEM := testCertificate(t, "ca", nil, nil)
+	_, _, leafPEM := testCertificate(t, "leaf", ca, caKey)
+	_, _, rootPEM := testCertificate(t, "root", nil, nil)
+	chain := append(append([]byte{}, leafPEM...), caPEM...)
+
+	bundle, err := CABundle(&v1alpha1.ACMEIssuer{}, chain)
+	a.NoError(err)
+	a.Nil(bundle, "CA bundle isn't stored")
+
+	bundle, err = CABundle(&v1alpha1.ACMEIssuer{CA: &v1alpha1.ACMECABundle{}}, chain)
+	a.NoError(err)
+	a.Equal(caPEM, bundle)
+
+	bundle, err = CABundle(&v1alpha1.ACMEIssuer{CA: &v1alpha1.ACMECABundle{Roots: rootPEM}}, chain)
+	a.NoError(err)
+	a.Equal(append(append([]byte{}, caPEM...), rootPEM...), bundle)
+}
+
+func TestWithRetryAfter(t *testing.T) {
+	a := assert.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+	rateLimited := &acme.ProblemDetails{Type: "urn:ietf:params:acme:error:rateLimited", HTTPStatus: 429}
+
+	config, err := NewConfig(NewUser("admin@example.com", nil), &v1alpha1.ACMEIssuer{Server: srv.URL})
+	a.NoError(err)
+	acmeErr, ok := injerr.AsACME(WithRetryAfter(config, rateLimited))
+	a.True(ok)
+	a.True(acmeErr.RetryAfter.IsZero(), "nothing was rate limited yet")
+
+	resp, err := config.HTTPClient.Get(srv.URL)
+	a.NoError(err)
+	resp.Body.Close()
+	acmeErr, ok = injerr.AsACME(WithRetryAfter(config, rateLimited))
+	a.True(ok)
+	a.WithinDuration(time.Now().Add(time.Hour), acmeErr.RetryAfter, time.Minute)
+	a.NoError(WithRetryAfter(config, nil))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	a := assert.New(t)
+	now := time.Date(2022, 8, 1, 10, 0, 0, 0, time.UTC)
+	retryAfter, ok := parseRetryAfter("120", now)
+	a.True(ok)
+	a.Equal(now.Add(2*time.Minute), retryAfter)
+	retryAfter, ok = parseRetryAfter("Mon, 01 Aug 2022 10:11:12 GMT", now)
+	a.True(ok)
+	a.True(retryAfter.Equal(time.Date(2022, 8, 1, 10, 11, 12, 0, time.UTC)))
+	_, ok = parseRetryAfter("", now)
+	a.False(ok)
+}
@@ -0,0 +1,120 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package issuer
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-acme/lego/v4/lego"
+	"github.com/onmetal/injector/api/v1alpha1"
+	injerr "github.com/onmetal/injector/internal/errors"
+	"github.com/onmetal/injector/internal/kubernetes"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CSRKey is the default key of the certificate signing request in its secret.
+const CSRKey = "tls.csr"
+
+// GetCertificateRequest returns the parsed certificate signing request of the certificate. The request must be
+// signed by its private key and its DNS names must match the domains of the certificate.
+func GetCertificateRequest(ctx context.Context, c client.Client, crt *v1alpha1.Certificate) (*x509.CertificateRequest, error) {
+	ref := crt.Spec.CSR
+	if ref == nil {
+		return nil, injerr.NotExist("certificate signing request")
+	}
+	data := ref.Request
+	if ref.SecretRef != nil {
+		key := ref.SecretRef.Key
+		if key == "" {
+			key = CSRKey
+		}
+		secret, err := kubernetes.GetSecret(ctx, c, ctrl.Request{NamespacedName: types.NamespacedName{
+			Namespace: crt.Namespace,
+			Name:      ref.SecretRef.Name,
+		}})
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if data, ok = secret.Data[key]; !ok {
+			return nil, fmt.Errorf("key %s not found in certificate signing request secret %s", key, ref.SecretRef.Name)
+		}
+	}
+	if len(data) == 0 {
+		return nil, injerr.NotExist("certificate signing request")
+	}
+	csr, err := certcrypto.PemDecodeTox509CSR(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid signature of certificate signing request: %w", err)
+	}
+	if err := validateRequestDomains(csr, crt.Spec.Domains); err != nil {
+		return nil, err
+	}
+	return csr, nil
+}
+
+func validateRequestDomains(csr *x509.CertificateRequest, domains []string) error {
+	requested := make(map[string]struct{}, len(domains))
+	for _, d := range domains {
+		requested[d] = struct{}{}
+	}
+	actual := make(map[string]struct{}, len(requested))
+	var unexpected []string
+	for _, d := range certcrypto.ExtractDomainsCSR(csr) {
+		if _, ok := requested[d]; !ok {
+			unexpected = append(unexpected, d)
+		}
+		actual[d] = struct{}{}
+	}
+	var missing []string
+	for d := range requested {
+		if _, ok := actual[d]; !ok {
+			missing = append(missing, d)
+		}
+	}
+	if len(unexpected) == 0 && len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	sort.Strings(unexpected)
+	return fmt.Errorf("DNS names of certificate signing request don't match the domains, missing [%s], not requested [%s]",
+		strings.Join(missing, ", "), strings.Join(unexpected, ", "))
+}
+
+// ObtainForRequest obtains a certificate for the certificate signing request of the certificate,
+// the returned resource doesn't contain a private key.
+func ObtainForRequest(ctx context.Context, c client.Client, legoClient *lego.Client, crt *v1alpha1.Certificate) (*certificate.Resource, error) {
+	csr, err := GetCertificateRequest(ctx, c, crt)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := legoClient.Certificate.ObtainForCSR(certificate.ObtainForCSRRequest{CSR: csr, Bundle: true})
+	if err != nil {
+		return nil, err
+	}
+	cert.PrivateKey = nil
+	cert.CSR = nil
+	return cert, nil
+}
@@ -0,0 +1,73 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package issuer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/pem"
+	"testing"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/onmetal/injector/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func testRequest(t *testing.T, domains ...string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := certcrypto.GenerateCSR(key, domains[0], domains, false)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+func TestGetCertificateRequest(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	request := testRequest(t, "example.com", "www.example.com")
+	c := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "csr", Namespace: "default"},
+		Data:       map[string][]byte{CSRKey: request},
+	}).Build()
+	crt := &v1alpha1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: v1alpha1.CertificateSpec{
+			Domains: []string{"www.example.com", "example.com"},
+			CSR:     &v1alpha1.CertificateSigningRequest{Request: request},
+		},
+	}
+	csr, err := GetCertificateRequest(ctx, c, crt)
+	a.NoError(err)
+	a.Equal("example.com", csr.Subject.CommonName)
+
+	crt.Spec.CSR = &v1alpha1.CertificateSigningRequest{SecretRef: &v1alpha1.SecretKeySelector{Name: "csr"}}
+	_, err = GetCertificateRequest(ctx, c, crt)
+	a.NoError(err)
+
+	crt.Spec.CSR.SecretRef.Key = "request.pem"
+	_, err = GetCertificateRequest(ctx, c, crt)
+	a.EqualError(err, "key request.pem not found in certificate signing request secret csr")
+
+	crt.Spec.Domains = []string{"example.com", "api.example.com"}
+	crt.Spec.CSR = &v1alpha1.CertificateSigningRequest{Request: request}
+	_, err = GetCertificateRequest(ctx, c, crt)
+	a.EqualError(err, "DNS names of certificate signing request don't match the domains, "+
+		"missing [api.example.com], not requested [www.example.com]")
+}
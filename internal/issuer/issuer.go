@@ -20,8 +20,10 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/x509"
+	"fmt"
 
-	"github.com/onmetal/injector/internal/issuer/solver"
+	"github.com/onmetal/injector/api/v1alpha1"
+	injerr "github.com/onmetal/injector/internal/errors"
 
 	apierr "k8s.io/apimachinery/pkg/api/errors"
 
@@ -33,7 +35,6 @@ import (
 	"github.com/onmetal/injector/internal/kubernetes"
 
 	"github.com/go-acme/lego/v4/certificate"
-	injerr "github.com/onmetal/injector/internal/errors"
 	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -43,18 +44,7 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
-const (
-	defaultEmail         = "your@email.local"
-	privateKeySecretName = "le-issuer"
-)
-
-const (
-	EmailAnnotationKey = "cert.injector.ko/email"
-	CaURLAnnotationKey = "cert.injector.ko/ca-url"
-)
-
 type Issuer interface {
-	RegisterAccount() error
 	RegisterChallengeProvider() error
 	Obtain() (*certificate.Resource, error)
 }
@@ -62,9 +52,12 @@ type Issuer interface {
 type certs struct {
 	ctx        context.Context
 	legoClient *lego.Client
+	config     *lego.Config
 	k8sClient  client.Client
 	log        logr.Logger
-	svc        *corev1.Service
+	crt        *v1alpha1.Certificate
+	gi         v1alpha1.GenericIssuer
+	acme       *v1alpha1.ACMEIssuer
 	User       *User
 	cert       *certificate.Resource
 }
@@ -88,24 +81,29 @@ func (u *User) GetPrivateKey() crypto.PrivateKey {
 	return u.Key
 }
 
-func New(ctx context.Context, k8sClient client.Client, l logr.Logger, req ctrl.Request) (Issuer, error) {
-	service, err := kubernetes.GetService(ctx, k8sClient, req)
+func New(ctx context.Context, k8sClient client.Client, l logr.Logger, crt *v1alpha1.Certificate) (Issuer, error) {
+	gi, err := GetIssuer(ctx, k8sClient, crt)
 	if err != nil {
 		return nil, err
 	}
-	if !isRequired(service.Annotations) {
-		return nil, injerr.NotRequired()
-	}
-	caURL := GetConfig(CaURLAnnotationKey, service.Annotations)
-	email := GetConfig(EmailAnnotationKey, service.Annotations)
+	acme := gi.GetSpec().ACME
 
-	privateKey, err := GetPrivateKey(ctx, k8sClient, req.Namespace)
+	privateKey, err := GetPrivateKey(ctx, k8sClient, gi)
 	if err != nil {
 		return nil, err
 	}
 
-	user := newUser(email, privateKey)
-	config := NewConfig(user, caURL)
+	user := NewUser(acme.Email, privateKey)
+	// the account is used by its URL, only the issuer controller registers it: a registration per certificate
+	// would create accounts which aren't stored and use up one-time external account bindings
+	user.Registration = AccountRegistration(gi, privateKey)
+	if user.Registration == nil {
+		return nil, injerr.NotReady(fmt.Sprintf("account of issuer %s", gi.GetName()))
+	}
+	config, err := NewConfig(user, acme)
+	if err != nil {
+		return nil, err
+	}
 
 	legoClient, err := lego.NewClient(config)
 	if err != nil {
@@ -115,35 +113,38 @@ func New(ctx context.Context, k8sClient client.Client, l logr.Logger, req ctrl.R
 	return &certs{
 		ctx:        ctx,
 		legoClient: legoClient,
+		config:     config,
 		k8sClient:  k8sClient,
 		log:        l,
-		svc:        service,
+		crt:        crt,
+		gi:         gi,
+		acme:       acme,
 		User:       user,
 	}, nil
 }
 
-func isRequired(m map[string]string) bool {
-	v, ok := m[solver.InjectAnnotationKey]
-	return ok && v == "true"
-}
-
-func GetPrivateKey(ctx context.Context, c client.Client, namespace string) (*ecdsa.PrivateKey, error) {
+// GetPrivateKey returns the private key of the ACME account of the issuer, the key is created if it doesn't exist.
+func GetPrivateKey(ctx context.Context, c client.Client, gi v1alpha1.GenericIssuer) (*ecdsa.PrivateKey, error) {
+	ref := gi.GetSpec().ACME.PrivateKeySecretRef
+	key := ref.Key
+	if key == "" {
+		key = corev1.TLSPrivateKeyKey
+	}
 	objKey := ctrl.Request{NamespacedName: types.NamespacedName{
-		Namespace: namespace,
-		Name:      privateKeySecretName,
+		Namespace: ResourceNamespace(gi),
+		Name:      ref.Name,
 	}}
 	secretPrivateKey, err := kubernetes.GetSecret(ctx, c, objKey)
-	if err != nil && apierr.IsNotFound(err) {
-		privateKey, err := createPrivateKey(ctx, c, namespace)
-		if err != nil {
-			return nil, err
+	if err != nil {
+		if apierr.IsNotFound(err) {
+			return createPrivateKey(ctx, c, objKey.NamespacedName, key)
 		}
-		return privateKey, nil
+		return nil, err
 	}
-	return x509.ParseECPrivateKey(secretPrivateKey.Data[corev1.TLSPrivateKeyKey])
+	return x509.ParseECPrivateKey(secretPrivateKey.Data[key])
 }
 
-func createPrivateKey(ctx context.Context, c client.Client, namespace string) (*ecdsa.PrivateKey, error) {
+func createPrivateKey(ctx context.Context, c client.Client, obj types.NamespacedName, key string) (*ecdsa.PrivateKey, error) {
 	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
 		return nil, err
@@ -152,50 +153,26 @@ func createPrivateKey(ctx context.Context, c client.Client, namespace string) (*
 	if err != nil {
 		return nil, err
 	}
-	preparedSecret := preparePrivateKeySecret(data, namespace)
+	preparedSecret := preparePrivateKeySecret(data, obj, key)
 	if createErr := kubernetes.CreateSecret(ctx, c, preparedSecret); createErr != nil {
 		return nil, createErr
 	}
 	return privateKey, err
 }
 
-func preparePrivateKeySecret(data []byte, namespace string) *corev1.Secret {
+func preparePrivateKeySecret(data []byte, obj types.NamespacedName, key string) *corev1.Secret {
 	return &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{Name: privateKeySecretName, Namespace: namespace},
+		ObjectMeta: metav1.ObjectMeta{Name: obj.Name, Namespace: obj.Namespace},
 		Immutable:  pointer.Bool(true),
-		Data:       map[string][]byte{corev1.TLSPrivateKeyKey: data},
+		Data:       map[string][]byte{key: data},
 		Type:       corev1.SecretTypeOpaque,
 	}
 }
 
-func GetConfig(s string, m map[string]string) string {
-	switch s {
-	case CaURLAnnotationKey:
-		v, ok := m[CaURLAnnotationKey]
-		if !ok {
-			return lego.LEDirectoryStaging
-		}
-		return v
-	case EmailAnnotationKey:
-		v, ok := m[EmailAnnotationKey]
-		if !ok {
-			return defaultEmail
-		}
-		return v
-	default:
-		return ""
-	}
-}
-
-func newUser(email string, privateKey *ecdsa.PrivateKey) *User {
+// NewUser returns the ACME account user for the email and private key.
+func NewUser(email string, privateKey *ecdsa.PrivateKey) *User {
 	return &User{
 		Email: email,
 		Key:   privateKey,
 	}
 }
-
-func NewConfig(u *User, caURL string) *lego.Config {
-	config := lego.NewConfig(u)
-	config.CADirURL = caURL
-	return config
-}
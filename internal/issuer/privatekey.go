@@ -0,0 +1,168 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package issuer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-acme/lego/v4/lego"
+	"github.com/onmetal/injector/api/v1alpha1"
+	injerr "github.com/onmetal/injector/internal/errors"
+)
+
+const (
+	defaultRSAKeySize   = 2048
+	defaultECDSAKeySize = 256
+)
+
+// privateKeyPolicy returns the algorithm and size of the private key of the certificate with defaults applied.
+func privateKeyPolicy(crt *v1alpha1.Certificate) (string, int, error) {
+	algorithm, size := v1alpha1.PrivateKeyAlgorithmRSA, 0
+	if pk := crt.Spec.PrivateKey; pk != nil {
+		if pk.Algorithm != "" {
+			algorithm = pk.Algorithm
+		}
+		size = pk.Size
+	}
+	switch algorithm {
+	case v1alpha1.PrivateKeyAlgorithmRSA:
+		if size == 0 {
+			size = defaultRSAKeySize
+		}
+		if size != 2048 && size != 3072 && size != 4096 {
+			return "", 0, fmt.Errorf("unsupported RSA key size %d", size)
+		}
+	case v1alpha1.PrivateKeyAlgorithmECDSA:
+		if size == 0 {
+			size = defaultECDSAKeySize
+		}
+		if size != 256 && size != 384 {
+			return "", 0, fmt.Errorf("unsupported ECDSA key size %d", size)
+		}
+	case v1alpha1.PrivateKeyAlgorithmEd25519:
+		size = 0
+	default:
+		return "", 0, fmt.Errorf("unsupported private key algorithm %s", algorithm)
+	}
+	return algorithm, size, nil
+}
+
+// GeneratePrivateKey returns a new private key for the certificate.
+func GeneratePrivateKey(crt *v1alpha1.Certificate) (crypto.Signer, error) {
+	algorithm, size, err := privateKeyPolicy(crt)
+	if err != nil {
+		return nil, err
+	}
+	switch algorithm {
+	case v1alpha1.PrivateKeyAlgorithmECDSA:
+		curve := elliptic.P256()
+		if size == 384 {
+			curve = elliptic.P384()
+		}
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	case v1alpha1.PrivateKeyAlgorithmEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return rsa.GenerateKey(rand.Reader, size)
+}
+
+// RenewalPrivateKey returns the private key the certificate is renewed with. The current key is reused
+// with the Never rotation policy as long as it matches the algorithm and size of the certificate.
+func RenewalPrivateKey(crt *v1alpha1.Certificate, currentKeyPEM []byte) (crypto.Signer, error) {
+	if pk := crt.Spec.PrivateKey; pk != nil && pk.RotationPolicy == v1alpha1.RotationPolicyAlways {
+		return GeneratePrivateKey(crt)
+	}
+	algorithm, size, err := privateKeyPolicy(crt)
+	if err != nil {
+		return nil, err
+	}
+	if len(currentKeyPEM) == 0 {
+		return GeneratePrivateKey(crt)
+	}
+	current, err := certcrypto.ParsePEMPrivateKey(currentKeyPEM)
+	if err != nil {
+		return GeneratePrivateKey(crt)
+	}
+	switch key := current.(type) {
+	case *rsa.PrivateKey:
+		if algorithm == v1alpha1.PrivateKeyAlgorithmRSA && key.N.BitLen() == size {
+			return key, nil
+		}
+	case *ecdsa.PrivateKey:
+		if algorithm == v1alpha1.PrivateKeyAlgorithmECDSA && key.Curve.Params().BitSize == size {
+			return key, nil
+		}
+	case ed25519.PrivateKey:
+		if algorithm == v1alpha1.PrivateKeyAlgorithmEd25519 {
+			return key, nil
+		}
+	}
+	return GeneratePrivateKey(crt)
+}
+
+// EncodePrivateKey returns the PEM encoded private key, Ed25519 keys are encoded as PKCS#8.
+func EncodePrivateKey(key crypto.Signer) ([]byte, error) {
+	if _, ok := key.(ed25519.PrivateKey); !ok {
+		return certcrypto.PEMEncode(key), nil
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// ObtainWithPrivateKey obtains a certificate for the domains of the certificate which is signed for the private key.
+func ObtainWithPrivateKey(legoClient *lego.Client, crt *v1alpha1.Certificate, key crypto.Signer) (*certificate.Resource, error) {
+	csr, err := privateKeyRequest(crt, key)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := EncodePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := legoClient.Certificate.ObtainForCSR(certificate.ObtainForCSRRequest{CSR: csr, Bundle: true})
+	if err != nil {
+		return nil, err
+	}
+	cert.PrivateKey = keyPEM
+	// the key is stored with the certificate, renewals don't use the CSR
+	cert.CSR = nil
+	return cert, nil
+}
+
+// privateKeyRequest returns the signing request of the private key for the domains of the certificate.
+func privateKeyRequest(crt *v1alpha1.Certificate, key crypto.Signer) (*x509.CertificateRequest, error) {
+	domains := crt.Spec.Domains
+	if len(domains) == 0 {
+		return nil, injerr.NotExist("domain name")
+	}
+	der, err := certcrypto.GenerateCSR(key, domains[0], domains, crt.Spec.MustStaple)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificateRequest(der)
+}
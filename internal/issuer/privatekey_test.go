@@ -0,0 +1,110 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package issuer
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/onmetal/injector/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeneratePrivateKey(t *testing.T) {
+	a := assert.New(t)
+	crt := &v1alpha1.Certificate{}
+	key, err := GeneratePrivateKey(crt)
+	a.NoError(err)
+	a.IsType(&rsa.PrivateKey{}, key)
+	a.Equal(2048, key.(*rsa.PrivateKey).N.BitLen())
+
+	crt.Spec.PrivateKey = &v1alpha1.CertificatePrivateKey{Algorithm: v1alpha1.PrivateKeyAlgorithmECDSA, Size: 384}
+	key, err = GeneratePrivateKey(crt)
+	a.NoError(err)
+	a.Equal(384, key.(*ecdsa.PrivateKey).Curve.Params().BitSize)
+
+	crt.Spec.PrivateKey = &v1alpha1.CertificatePrivateKey{Algorithm: v1alpha1.PrivateKeyAlgorithmEd25519}
+	key, err = GeneratePrivateKey(crt)
+	a.NoError(err)
+	keyPEM, err := EncodePrivateKey(key)
+	a.NoError(err)
+	parsed, err := certcrypto.ParsePEMPrivateKey(keyPEM)
+	a.NoError(err)
+	a.Equal(key, parsed)
+
+	crt.Spec.PrivateKey = &v1alpha1.CertificatePrivateKey{Algorithm: v1alpha1.PrivateKeyAlgorithmECDSA, Size: 2048}
+	_, err = GeneratePrivateKey(crt)
+	a.EqualError(err, "unsupported ECDSA key size 2048")
+}
+
+func TestRenewalPrivateKey(t *testing.T) {
+	a := assert.New(t)
+	crt := &v1alpha1.Certificate{Spec: v1alpha1.CertificateSpec{
+		PrivateKey: &v1alpha1.CertificatePrivateKey{Algorithm: v1alpha1.PrivateKeyAlgorithmECDSA},
+	}}
+	current, err := GeneratePrivateKey(crt)
+	a.NoError(err)
+	currentPEM, err := EncodePrivateKey(current)
+	a.NoError(err)
+
+	key, err := RenewalPrivateKey(crt, currentPEM)
+	a.NoError(err)
+	a.Equal(current, key, "the key is reused by default")
+
+	crt.Spec.PrivateKey.RotationPolicy = v1alpha1.RotationPolicyAlways
+	key, err = RenewalPrivateKey(crt, currentPEM)
+	a.NoError(err)
+	a.NotEqual(current, key)
+
+	crt.Spec.PrivateKey = &v1alpha1.CertificatePrivateKey{
+		Algorithm:      v1alpha1.PrivateKeyAlgorithmEd25519,
+		RotationPolicy: v1alpha1.RotationPolicyNever,
+	}
+	key, err = RenewalPrivateKey(crt, currentPEM)
+	a.NoError(err)
+	a.IsType(ed25519.PrivateKey{}, key, "the key is regenerated if the algorithm changed")
+
+	key, err = RenewalPrivateKey(crt, nil)
+	a.NoError(err)
+	a.IsType(ed25519.PrivateKey{}, key)
+}
+
+func TestPrivateKeyRequest(t *testing.T) {
+	a := assert.New(t)
+	mustStaple := asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+	hasMustStaple := func(crt *v1alpha1.Certificate) bool {
+		key, err := GeneratePrivateKey(crt)
+		a.NoError(err)
+		csr, err := privateKeyRequest(crt, key)
+		a.NoError(err)
+		a.Equal([]string{"example.com", "www.example.com"}, csr.DNSNames)
+		for _, ext := range csr.Extensions {
+			if ext.Id.Equal(mustStaple) {
+				return true
+			}
+		}
+		return false
+	}
+	crt := &v1alpha1.Certificate{Spec: v1alpha1.CertificateSpec{Domains: []string{"example.com", "www.example.com"}}}
+	a.False(hasMustStaple(crt))
+	crt.Spec.MustStaple = true
+	a.True(hasMustStaple(crt))
+
+	_, err := privateKeyRequest(&v1alpha1.Certificate{}, nil)
+	a.Error(err)
+}
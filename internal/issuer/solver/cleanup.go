@@ -0,0 +1,150 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package solver
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// challengeAnnotationKey marks a service which is switched to a resolver pod,
+	// the value is the time the challenge started in RFC 3339 format.
+	challengeAnnotationKey = "cert.injector.ko/acme-challenge"
+	// resolverFinalizer keeps a resolver pod until the service is switched back to the application.
+	resolverFinalizer = "cert.injector.ko/acme-resolver"
+)
+
+// markChallenge records on the service that it's switched to a resolver pod,
+// so the change can be reverted by the Sweeper if the controller dies before the clean-up.
+func markChallenge(svc *corev1.Service) {
+	if svc.Annotations == nil {
+		svc.Annotations = map[string]string{}
+	}
+	if _, ok := svc.Annotations[challengeAnnotationKey]; !ok {
+		svc.Annotations[challengeAnnotationKey] = time.Now().UTC().Format(time.RFC3339)
+	}
+}
+
+// challengeStarted returns the time the challenge of the service started.
+// A mark which can't be parsed and a resolver selector without mark, which is left by previous versions,
+// are treated as started at the zero time.
+func challengeStarted(svc *corev1.Service) (time.Time, bool) {
+	v, ok := svc.Annotations[challengeAnnotationKey]
+	if !ok {
+		_, ok = svc.Spec.Selector[resolverLabelKey]
+		return time.Time{}, ok
+	}
+	started, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, true
+	}
+	return started, true
+}
+
+// ownResolverPod ties the resolver pod to the service, so it's removed with the service and
+// isn't removed before the service is switched back. Shared resolvers aren't owned by a service.
+func (e *kubernetes) ownResolverPod(pod *corev1.Pod) {
+	if e.svc.UID != "" && !e.shared() {
+		pod.OwnerReferences = append(pod.OwnerReferences, metav1.OwnerReference{
+			APIVersion: "v1",
+			Kind:       "Service",
+			Name:       e.svc.Name,
+			UID:        e.svc.UID,
+		})
+	}
+	controllerutil.AddFinalizer(pod, resolverFinalizer)
+}
+
+// cleanUp switches the service back to the application and removes the resolver pods of the service,
+// a shared resolver keeps running for the other services of the namespace.
+func (e *kubernetes) cleanUp() error {
+	if err := e.deleteEndpointSlices(); err != nil {
+		e.log.Info("can't delete endpoint slices of resolver", "error", err)
+		return err
+	}
+	if err := e.restoreService(); client.IgnoreNotFound(err) != nil {
+		e.log.Info("can't restore service", "error", err)
+		return err
+	}
+	return e.deleteResolverPods()
+}
+
+// restoreService reverts the changes of the challenge to the service.
+func (e *kubernetes) restoreService() error {
+	if err := e.Get(e.ctx, client.ObjectKeyFromObject(e.svc), e.svc); err != nil {
+		return err
+	}
+	changed := e.restoreChallengePort()
+	if _, ok := e.svc.Spec.Selector[resolverLabelKey]; ok {
+		delete(e.svc.Spec.Selector, resolverLabelKey)
+		changed = true
+	}
+	if _, ok := e.svc.Annotations[challengeAnnotationKey]; ok {
+		delete(e.svc.Annotations, challengeAnnotationKey)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	e.log.Info("reverting service to application", "service", e.svc.Name)
+	return e.Update(e.ctx, e.svc)
+}
+
+// unmarkChallenge removes the challenge mark of the service without reverting it.
+func (e *kubernetes) unmarkChallenge() error {
+	if err := e.Get(e.ctx, client.ObjectKeyFromObject(e.svc), e.svc); err != nil {
+		return err
+	}
+	if _, ok := e.svc.Annotations[challengeAnnotationKey]; !ok {
+		return nil
+	}
+	delete(e.svc.Annotations, challengeAnnotationKey)
+	return e.Update(e.ctx, e.svc)
+}
+
+// deleteResolverPods deletes the resolver pods of the service and releases their finalizer.
+func (e *kubernetes) deleteResolverPods() error {
+	pods := &corev1.PodList{}
+	if err := e.List(e.ctx, pods, client.InNamespace(e.svc.Namespace),
+		client.MatchingLabels{resolverLabelKey: ResolverEnabled, serviceLabelKey: e.svc.Name}); err != nil {
+		e.log.Info("can't list acme resolver pods", "error", err)
+		return err
+	}
+	for i := range pods.Items {
+		if err := e.deleteResolverPod(&pods.Items[i]); err != nil {
+			e.log.Info("can't delete acme resolver pod", "error", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *kubernetes) deleteResolverPod(pod *corev1.Pod) error {
+	if controllerutil.ContainsFinalizer(pod, resolverFinalizer) {
+		base := pod.DeepCopy()
+		controllerutil.RemoveFinalizer(pod, resolverFinalizer)
+		if err := e.Patch(e.ctx, pod, client.MergeFrom(base)); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+	}
+	if pod.DeletionTimestamp != nil {
+		return nil
+	}
+	return client.IgnoreNotFound(e.Delete(e.ctx, pod))
+}
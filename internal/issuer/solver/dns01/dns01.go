@@ -0,0 +1,143 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dns01 builds the DNS providers which solve DNS-01 challenges from the issuer configuration.
+// The providers of lego are used, any of them satisfies solver.Provider.
+package dns01
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	legodns01 "github.com/go-acme/lego/v4/challenge/dns01"
+	"github.com/go-acme/lego/v4/providers/dns/httpreq"
+	"github.com/go-acme/lego/v4/providers/dns/rfc2136"
+	"github.com/onmetal/injector/api/v1alpha1"
+	injerr "github.com/onmetal/injector/internal/errors"
+	"github.com/onmetal/injector/internal/issuer/solver"
+	"github.com/onmetal/injector/internal/kubernetes"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	defaultTSIGSecretKey = "secret"
+	usernameKey          = "username"
+	passwordKey          = "password"
+)
+
+const webhookTimeout = 30 * time.Second
+
+// New returns the DNS provider configured by the solver.
+// Secrets referenced by the configuration are read from the namespace.
+func New(ctx context.Context, c client.Client, namespace string, cfg *v1alpha1.ACMEDNS01Solver) (solver.Provider, error) {
+	switch {
+	case cfg.RFC2136 != nil && cfg.Webhook != nil:
+		return nil, errors.New("dns01 solver has to configure exactly one provider")
+	case cfg.RFC2136 != nil:
+		return newRFC2136(ctx, c, namespace, cfg)
+	case cfg.Webhook != nil:
+		return newWebhook(ctx, c, namespace, cfg)
+	default:
+		return nil, injerr.NotExist("dns01 provider")
+	}
+}
+
+// ChallengeOptions returns the options of the DNS-01 challenge configured by the solver.
+func ChallengeOptions(cfg *v1alpha1.ACMEDNS01Solver) []legodns01.ChallengeOption {
+	if len(cfg.RecursiveNameservers) == 0 {
+		return nil
+	}
+	return []legodns01.ChallengeOption{
+		legodns01.AddRecursiveNameservers(legodns01.ParseNameservers(cfg.RecursiveNameservers)),
+	}
+}
+
+func newRFC2136(ctx context.Context, c client.Client, namespace string, cfg *v1alpha1.ACMEDNS01Solver) (solver.Provider, error) {
+	spec := cfg.RFC2136
+	config := rfc2136.NewDefaultConfig()
+	config.Nameserver = spec.Nameserver
+	config.TSIGKey = spec.TSIGKeyName
+	if spec.TSIGAlgorithm != "" {
+		config.TSIGAlgorithm = legodns01.ToFqdn(spec.TSIGAlgorithm)
+	}
+	if cfg.PropagationTimeout != nil {
+		config.PropagationTimeout = cfg.PropagationTimeout.Duration
+	}
+	if ref := spec.TSIGSecretSecretRef; ref != nil {
+		key := ref.Key
+		if key == "" {
+			key = defaultTSIGSecretKey
+		}
+		data, err := getSecretData(ctx, c, namespace, ref.Name)
+		if err != nil {
+			return nil, err
+		}
+		secret, ok := data[key]
+		if !ok {
+			return nil, injerr.NotExist(fmt.Sprintf("key %s of secret %s", key, ref.Name))
+		}
+		config.TSIGSecret = string(secret)
+	}
+	return rfc2136.NewDNSProviderConfig(config)
+}
+
+func newWebhook(ctx context.Context, c client.Client, namespace string, cfg *v1alpha1.ACMEDNS01Solver) (solver.Provider, error) {
+	spec := cfg.Webhook
+	endpoint, err := url.Parse(spec.URL)
+	if err != nil {
+		return nil, err
+	}
+	config := httpreq.NewDefaultConfig()
+	config.Endpoint = endpoint
+	config.HTTPClient = &http.Client{Timeout: webhookTimeout}
+	if cfg.PropagationTimeout != nil {
+		config.PropagationTimeout = cfg.PropagationTimeout.Duration
+	}
+	if len(spec.CABundle) != 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(spec.CABundle) {
+			return nil, fmt.Errorf("can't parse CA bundle of webhook %s", spec.URL)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+		config.HTTPClient.Transport = transport
+	}
+	if ref := spec.CredentialsSecretRef; ref != nil {
+		data, err := getSecretData(ctx, c, namespace, ref.Name)
+		if err != nil {
+			return nil, err
+		}
+		config.Username = string(data[usernameKey])
+		config.Password = string(data[passwordKey])
+	}
+	return httpreq.NewDNSProviderConfig(config)
+}
+
+func getSecretData(ctx context.Context, c client.Client, namespace, name string) (map[string][]byte, error) {
+	secret, err := kubernetes.GetSecret(ctx, c, ctrl.Request{NamespacedName: types.NamespacedName{
+		Namespace: namespace,
+		Name:      name,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	return secret.Data, nil
+}
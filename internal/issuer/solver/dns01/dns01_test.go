@@ -0,0 +1,65 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dns01
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-acme/lego/v4/providers/dns/httpreq"
+	"github.com/go-acme/lego/v4/providers/dns/rfc2136"
+	"github.com/onmetal/injector/api/v1alpha1"
+	injerr "github.com/onmetal/injector/internal/errors"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestNew(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	c := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "tsig", Namespace: "default"},
+		Data:       map[string][]byte{defaultTSIGSecretKey: []byte("c2VjcmV0")},
+	}).Build()
+
+	p, err := New(ctx, c, "default", &v1alpha1.ACMEDNS01Solver{RFC2136: &v1alpha1.ACMEDNS01RFC2136{
+		Nameserver:          "127.0.0.1",
+		TSIGKeyName:         "injector.",
+		TSIGAlgorithm:       "hmac-sha256",
+		TSIGSecretSecretRef: &v1alpha1.SecretKeySelector{Name: "tsig"},
+	}})
+	a.NoError(err)
+	a.IsType(&rfc2136.DNSProvider{}, p)
+
+	p, err = New(ctx, c, "default", &v1alpha1.ACMEDNS01Solver{Webhook: &v1alpha1.ACMEDNS01Webhook{URL: "http://dns.local"}})
+	a.NoError(err)
+	a.IsType(&httpreq.DNSProvider{}, p)
+
+	_, err = New(ctx, c, "default", &v1alpha1.ACMEDNS01Solver{RFC2136: &v1alpha1.ACMEDNS01RFC2136{
+		Nameserver:          "127.0.0.1",
+		TSIGSecretSecretRef: &v1alpha1.SecretKeySelector{Name: "tsig", Key: "missing"},
+	}})
+	a.True(injerr.IsNotExist(err))
+
+	_, err = New(ctx, c, "default", &v1alpha1.ACMEDNS01Solver{})
+	a.True(injerr.IsNotExist(err))
+
+	_, err = New(ctx, c, "default", &v1alpha1.ACMEDNS01Solver{
+		RFC2136: &v1alpha1.ACMEDNS01RFC2136{Nameserver: "127.0.0.1"},
+		Webhook: &v1alpha1.ACMEDNS01Webhook{URL: "http://dns.local"},
+	})
+	a.Error(err)
+}
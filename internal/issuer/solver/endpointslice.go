@@ -0,0 +1,177 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package solver
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// acmeHTTPPortName is the target port of the challenge port while it's routed to the resolver.
+	// Application pods don't declare it, so the endpoint slice controller drops them from the challenge port.
+	acmeHTTPPortName = "acme-http"
+	// targetPortAnnotationKey stores the original target port of the challenge port of the service,
+	// it's empty if the port was added for the challenge.
+	targetPortAnnotationKey = "cert.injector.ko/acme-target-port"
+	serviceLabelKey         = "cert.injector.ko/service"
+	endpointSliceManagedBy  = "cert-injector"
+)
+
+// routeChallengePort points the challenge port of the service to a target port only the resolver serves,
+// the port is added if the service doesn't have it.
+func (e *kubernetes) routeChallengePort() error {
+	if _, ok := e.svc.Annotations[targetPortAnnotationKey]; ok {
+		return nil
+	}
+	original := ""
+	i := e.challengePortIndex()
+	if i < 0 {
+		for _, p := range e.svc.Spec.Ports {
+			if p.Name == "" {
+				return fmt.Errorf("can't add port %d to service %s with unnamed port", e.port, e.svc.Name)
+			}
+		}
+		e.svc.Spec.Ports = append(e.svc.Spec.Ports, corev1.ServicePort{
+			Name:     acmeHTTPPortName,
+			Port:     e.port,
+			Protocol: corev1.ProtocolTCP,
+		})
+		i = len(e.svc.Spec.Ports) - 1
+	} else {
+		original = e.svc.Spec.Ports[i].TargetPort.String()
+	}
+	e.svc.Spec.Ports[i].TargetPort = intstr.FromString(acmeHTTPPortName)
+	if e.svc.Annotations == nil {
+		e.svc.Annotations = map[string]string{}
+	}
+	e.svc.Annotations[targetPortAnnotationKey] = original
+	markChallenge(e.svc)
+	e.log.Info("routing service port to resolver", "port", e.port)
+	return e.Update(e.ctx, e.svc)
+}
+
+// restoreChallengePort restores the target port of the challenge port or removes the added port.
+// It reports whether the service was changed.
+func (e *kubernetes) restoreChallengePort() bool {
+	original, ok := e.svc.Annotations[targetPortAnnotationKey]
+	if !ok {
+		return false
+	}
+	if i := e.challengePortIndex(); i >= 0 {
+		if original == "" {
+			e.svc.Spec.Ports = append(e.svc.Spec.Ports[:i], e.svc.Spec.Ports[i+1:]...)
+		} else {
+			e.svc.Spec.Ports[i].TargetPort = intstr.Parse(original)
+		}
+	}
+	delete(e.svc.Annotations, targetPortAnnotationKey)
+	return true
+}
+
+// ensureEndpointSlice publishes the resolver pod as endpoint of the challenge port of the service.
+func (e *kubernetes) ensureEndpointSlice(pod *corev1.Pod) error {
+	slices := &discoveryv1.EndpointSliceList{}
+	if err := e.List(e.ctx, slices, client.InNamespace(e.svc.Namespace),
+		client.MatchingLabels{serviceLabelKey: e.svc.Name, discoveryv1.LabelManagedBy: endpointSliceManagedBy}); err != nil {
+		return err
+	}
+	for _, slice := range slices.Items {
+		for _, ep := range slice.Endpoints {
+			if ep.TargetRef != nil && ep.TargetRef.UID == pod.UID {
+				return nil
+			}
+		}
+	}
+	return e.createEndpointSlice(pod)
+}
+
+func (e *kubernetes) createEndpointSlice(current *corev1.Pod) error {
+	if current.Status.PodIP == "" {
+		return fmt.Errorf("resolver pod %s has no IP", current.Name)
+	}
+	addressType := discoveryv1.AddressTypeIPv4
+	if strings.Contains(current.Status.PodIP, ":") {
+		addressType = discoveryv1.AddressTypeIPv6
+	}
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: fmt.Sprintf("%s-acme-", e.svc.Name),
+			Namespace:    e.svc.Namespace,
+			Labels: map[string]string{
+				discoveryv1.LabelServiceName: e.svc.Name,
+				discoveryv1.LabelManagedBy:   endpointSliceManagedBy,
+				serviceLabelKey:              e.svc.Name,
+			},
+			// the slice is removed with the pod
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "v1",
+				Kind:       "Pod",
+				Name:       current.Name,
+				UID:        current.UID,
+			}},
+		},
+		AddressType: addressType,
+		Endpoints: []discoveryv1.Endpoint{{
+			Addresses:  []string{current.Status.PodIP},
+			Conditions: discoveryv1.EndpointConditions{Ready: pointer.Bool(true)},
+			TargetRef: &corev1.ObjectReference{
+				Kind:      "Pod",
+				Namespace: current.Namespace,
+				Name:      current.Name,
+				UID:       current.UID,
+			},
+		}},
+		Ports: []discoveryv1.EndpointPort{{
+			Name:     pointer.String(e.challengePortName()),
+			Port:     pointer.Int32(defaultResolverPort),
+			Protocol: protocolTCP(),
+		}},
+	}
+	return e.Create(e.ctx, slice)
+}
+
+func (e *kubernetes) deleteEndpointSlices() error {
+	return e.DeleteAllOf(e.ctx, &discoveryv1.EndpointSlice{}, client.InNamespace(e.svc.Namespace),
+		client.MatchingLabels{serviceLabelKey: e.svc.Name, discoveryv1.LabelManagedBy: endpointSliceManagedBy})
+}
+
+func (e *kubernetes) challengePortIndex() int {
+	for i, p := range e.svc.Spec.Ports {
+		if p.Port == e.port {
+			return i
+		}
+	}
+	return -1
+}
+
+// challengePortName returns the name of the challenge port of the service.
+func (e *kubernetes) challengePortName() string {
+	if i := e.challengePortIndex(); i >= 0 {
+		return e.svc.Spec.Ports[i].Name
+	}
+	return acmeHTTPPortName
+}
+
+func protocolTCP() *corev1.Protocol {
+	p := corev1.ProtocolTCP
+	return &p
+}
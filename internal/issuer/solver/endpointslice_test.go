@@ -0,0 +1,135 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package solver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/onmetal/injector/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestEndpointSliceMode(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "injector", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": "nginx"},
+			Ports:    []corev1.ServicePort{{Name: "http", Port: 80, TargetPort: intstr.FromInt(8000)}},
+		},
+	}
+	c := fake.NewClientBuilder().WithObjects(svc).Build()
+	k := New(ctx, c, logr.Discard(), svc, &v1alpha1.ACMEHTTP01Solver{
+		Mode:      v1alpha1.SolverModeEndpointSlice,
+		SelfCheck: v1alpha1.SelfCheckNone,
+	}, nil).(*kubernetes)
+
+	pod, err := k.preparePod()
+	a.NoError(err)
+	a.Equal(map[string]string{resolverLabelKey: ResolverEnabled, sharedLabelKey: "true"}, pod.Labels)
+	a.Equal([]corev1.ContainerPort{{Name: acmeHTTPPortName, ContainerPort: defaultResolverPort, Protocol: corev1.ProtocolTCP}},
+		pod.Spec.Containers[0].Ports)
+	a.Empty(pod.OwnerReferences)
+
+	// the shared resolver of the namespace is running already
+	pod.Name = "acmeresolver-abc"
+	pod.Status.PodIP = "10.0.0.2"
+	pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	a.NoError(c.Create(ctx, pod))
+
+	resolver := map[string]string{}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret := &corev1.Secret{}
+		a.NoError(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: apiTokenSecretName}, secret))
+		if r.Header.Get("Authorization") != "Bearer "+string(secret.Data[apiTokenKey]) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		ch := apiChallenge{}
+		a.NoError(json.NewDecoder(r.Body).Decode(&ch))
+		if r.Method == http.MethodPut {
+			resolver[ch.Domain+"/"+ch.Token] = ch.KeyAuthorization
+		} else {
+			delete(resolver, ch.Domain+"/"+ch.Token)
+		}
+		fmt.Fprintf(w, `{"challenges":%d}`, len(resolver))
+	}))
+	defer api.Close()
+	k.resolverURL = func(*corev1.Pod) string { return api.URL }
+
+	a.NoError(k.Present("domain.com", "token", "key"))
+	a.NoError(k.Present("www.domain.com", "token2", "key2"))
+	a.Equal(map[string]string{"domain.com/token": "key", "www.domain.com/token2": "key2"}, resolver)
+
+	current := &corev1.Service{}
+	a.NoError(c.Get(ctx, client.ObjectKeyFromObject(svc), current))
+	a.Equal(intstr.FromString(acmeHTTPPortName), current.Spec.Ports[0].TargetPort)
+	a.Equal(map[string]string{"app": "nginx"}, current.Spec.Selector)
+
+	slices := &discoveryv1.EndpointSliceList{}
+	a.NoError(c.List(ctx, slices, client.MatchingLabels{discoveryv1.LabelServiceName: "injector"}))
+	a.Len(slices.Items, 1)
+	a.Equal("http", *slices.Items[0].Ports[0].Name)
+	a.Equal([]string{"10.0.0.2"}, slices.Items[0].Endpoints[0].Addresses)
+
+	a.NoError(k.CleanUp("domain.com", "token", "key"))
+	a.NoError(c.Get(ctx, client.ObjectKeyFromObject(svc), current))
+	a.Equal(intstr.FromString(acmeHTTPPortName), current.Spec.Ports[0].TargetPort)
+
+	a.NoError(k.CleanUp("www.domain.com", "token2", "key2"))
+	a.Empty(resolver)
+	a.NoError(c.Get(ctx, client.ObjectKeyFromObject(svc), current))
+	a.Equal(intstr.FromInt(8000), current.Spec.Ports[0].TargetPort)
+	a.NotContains(current.Annotations, targetPortAnnotationKey)
+	a.NoError(c.List(ctx, slices))
+	a.Empty(slices.Items)
+	pods := &corev1.PodList{}
+	a.NoError(c.List(ctx, pods))
+	a.Len(pods.Items, 1, "the shared resolver keeps running")
+}
+
+func TestRouteAddedChallengePort(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "injector", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "https", Port: 443}}},
+	}
+	c := fake.NewClientBuilder().WithObjects(svc).Build()
+	k := newKubernetes(ctx, c, logr.Discard(), svc, challengeTypeHTTP01, httpPort)
+	k.mode = v1alpha1.SolverModeEndpointSlice
+
+	a.NoError(k.routeChallengePort())
+	a.Len(svc.Spec.Ports, 2)
+	a.Equal(acmeHTTPPortName, k.challengePortName())
+
+	a.NoError(k.restoreService())
+	a.Equal([]corev1.ServicePort{{Name: "https", Port: 443}}, svc.Spec.Ports)
+
+	svc.Spec.Ports[0].Name = ""
+	a.Error(k.routeChallengePort())
+}
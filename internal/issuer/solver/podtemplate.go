@@ -0,0 +1,102 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package solver
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+)
+
+const unprivilegedPortSysctl = "net.ipv4.ip_unprivileged_port_start"
+
+// defaultContainerSecurityContext complies with the restricted pod security standard,
+// except for runAsNonRoot which depends on the image.
+func defaultContainerSecurityContext() *corev1.SecurityContext {
+	return &corev1.SecurityContext{
+		AllowPrivilegeEscalation: pointer.Bool(false),
+		Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+		SeccompProfile:           &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+	}
+}
+
+// applyPodTemplate merges the pod template of the issuer into the resolver pod.
+// Labels and environment the resolver depends on can't be overridden.
+func (e *kubernetes) applyPodTemplate(pod *corev1.Pod) {
+	tmpl := e.podTemplate
+	if tmpl == nil {
+		return
+	}
+	if m := tmpl.Metadata; m != nil {
+		for k, v := range m.Labels {
+			if _, ok := pod.Labels[k]; !ok {
+				pod.Labels[k] = v
+			}
+		}
+		if len(m.Annotations) != 0 && pod.Annotations == nil {
+			pod.Annotations = make(map[string]string, len(m.Annotations))
+		}
+		for k, v := range m.Annotations {
+			pod.Annotations[k] = v
+		}
+	}
+	spec := tmpl.Spec
+	if spec == nil {
+		return
+	}
+	container := &pod.Spec.Containers[0]
+	if spec.Image != "" {
+		container.Image = spec.Image
+	}
+	if spec.Resources != nil {
+		container.Resources = *spec.Resources.DeepCopy()
+	}
+	if spec.ContainerSecurityContext != nil {
+		container.SecurityContext = spec.ContainerSecurityContext.DeepCopy()
+	}
+	pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, spec.ImagePullSecrets...)
+	if spec.NodeSelector != nil {
+		pod.Spec.NodeSelector = spec.NodeSelector
+	}
+	pod.Spec.Tolerations = append(pod.Spec.Tolerations, spec.Tolerations...)
+	if spec.Affinity != nil {
+		pod.Spec.Affinity = spec.Affinity.DeepCopy()
+	}
+	if spec.PriorityClassName != "" {
+		pod.Spec.PriorityClassName = spec.PriorityClassName
+	}
+	if spec.ServiceAccountName != "" {
+		pod.Spec.ServiceAccountName = spec.ServiceAccountName
+	}
+	if spec.SecurityContext != nil {
+		sysctls := []corev1.Sysctl(nil)
+		if pod.Spec.SecurityContext != nil {
+			sysctls = pod.Spec.SecurityContext.Sysctls
+		}
+		pod.Spec.SecurityContext = spec.SecurityContext.DeepCopy()
+		for _, s := range sysctls {
+			if !hasSysctl(pod.Spec.SecurityContext.Sysctls, s.Name) {
+				pod.Spec.SecurityContext.Sysctls = append(pod.Spec.SecurityContext.Sysctls, s)
+			}
+		}
+	}
+}
+
+func hasSysctl(sysctls []corev1.Sysctl, name string) bool {
+	for _, s := range sysctls {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
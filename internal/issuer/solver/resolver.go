@@ -0,0 +1,194 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package solver
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/onmetal/injector/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Challenge api of the resolver pod, see app/acmeresolver.
+const (
+	apiTokenEnv    = "API_TOKEN"
+	apiPortEnv     = "API_PORT"
+	apiPort        = 8089
+	challengesPath = "/challenges"
+)
+
+const (
+	// apiTokenSecretName is the secret which stores the token of the challenge api of the resolvers in a namespace.
+	apiTokenSecretName = "acme-resolver-api"
+	apiTokenKey        = "token"
+	apiRequestTimeout  = 10 * time.Second
+	// sharedLabelKey marks the resolver pod which is shared by the services of a namespace.
+	sharedLabelKey = "cert.injector.ko/shared-resolver"
+)
+
+// apiChallenge is the challenge which is added to or removed from the resolver.
+type apiChallenge struct {
+	Domain           string `json:"domain"`
+	Token            string `json:"token"`
+	KeyAuthorization string `json:"keyAuthorization,omitempty"`
+}
+
+// shared returns whether the resolver is shared by the services of the namespace. Resolvers which are
+// selected by the service carry its selector and serve one service only.
+func (e *kubernetes) shared() bool {
+	return e.mode == v1alpha1.SolverModeEndpointSlice
+}
+
+// resolverLabels identify the resolver pod which serves the challenges of the service.
+func (e *kubernetes) resolverLabels() map[string]string {
+	if e.shared() {
+		return map[string]string{resolverLabelKey: ResolverEnabled, sharedLabelKey: "true"}
+	}
+	return map[string]string{resolverLabelKey: ResolverEnabled, serviceLabelKey: e.svc.Name}
+}
+
+// findResolver returns the running resolver pod of the service, nil if there is none.
+func (e *kubernetes) findResolver() (*corev1.Pod, error) {
+	pods := &corev1.PodList{}
+	if err := e.List(e.ctx, pods, client.InNamespace(e.svc.Namespace), client.MatchingLabels(e.resolverLabels())); err != nil {
+		return nil, err
+	}
+	for i := range pods.Items {
+		if pods.Items[i].DeletionTimestamp == nil {
+			return &pods.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// ensureResolver returns the resolver pod once it serves the challenge port of the service,
+// the pod is created if the service has none.
+func (e *kubernetes) ensureResolver() (*corev1.Pod, error) {
+	pod, err := e.startResolver()
+	if err != nil {
+		return nil, err
+	}
+	if e.shared() {
+		if err := e.routeChallengePort(); err != nil {
+			return nil, err
+		}
+		if err := e.ensureEndpointSlice(pod); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.poll(pod, e.resolverServed); err != nil {
+		return nil, err
+	}
+	return pod, nil
+}
+
+// startResolver returns the resolver pod once it's ready, the pod is created if it doesn't exist.
+func (e *kubernetes) startResolver() (*corev1.Pod, error) {
+	if _, err := e.apiToken(); err != nil {
+		return nil, err
+	}
+	pod, err := e.findResolver()
+	if err != nil {
+		return nil, err
+	}
+	if pod == nil {
+		if pod, err = e.preparePod(); err != nil {
+			return nil, err
+		}
+		if !e.shared() {
+			if err := e.changeServiceSelector(); err != nil {
+				return nil, err
+			}
+		}
+		if err := e.Create(e.ctx, pod); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.poll(pod, e.resolverReady); err != nil {
+		return nil, err
+	}
+	// the api of the resolver is reached by the IP of the pod
+	if err := e.Get(e.ctx, client.ObjectKeyFromObject(pod), pod); err != nil {
+		return nil, err
+	}
+	return pod, nil
+}
+
+// apiToken returns the token of the challenge api of the resolvers, it's created if it doesn't exist.
+func (e *kubernetes) apiToken() (string, error) {
+	secret := &corev1.Secret{}
+	err := e.Get(e.ctx, client.ObjectKey{Namespace: e.svc.Namespace, Name: apiTokenSecretName}, secret)
+	if err == nil {
+		return string(secret.Data[apiTokenKey]), nil
+	}
+	if !apierr.IsNotFound(err) {
+		return "", err
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: apiTokenSecretName, Namespace: e.svc.Namespace},
+		Data:       map[string][]byte{apiTokenKey: []byte(token)},
+	}
+	if err := e.Create(e.ctx, secret); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// updateChallenge adds the challenge to the resolver with PUT and removes it with DELETE.
+func (e *kubernetes) updateChallenge(pod *corev1.Pod, method string, ch apiChallenge) error {
+	token, err := e.apiToken()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(ch)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(e.ctx, method, e.resolverURL(pod)+challengesPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := (&http.Client{Timeout: apiRequestTimeout}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("resolver pod %s responded %s to %s of challenge %s", pod.Name, resp.Status, method, ch.Domain)
+	}
+	return nil
+}
+
+// podAPIURL returns the address of the challenge api of the resolver pod.
+func podAPIURL(pod *corev1.Pod) string {
+	return "http://" + net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(apiPort))
+}
@@ -0,0 +1,288 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package solver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+
+	"github.com/go-acme/lego/v4/challenge/http01"
+	"github.com/onmetal/injector/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// resolverServiceName is the service of the shared resolver of a namespace which routes point to.
+	resolverServiceName = "acme-resolver"
+	resolverServicePort = "http"
+	// challengeLabelKey identifies the route of a challenge by the hash of its domain and token.
+	challengeLabelKey = "cert.injector.ko/acme-challenge-hash"
+	managedByLabelKey = "app.kubernetes.io/managed-by"
+)
+
+var httpRouteGVK = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "HTTPRoute"}
+
+// route solves http-01 challenges by routing the challenge path of the domain to the shared resolver of the
+// namespace with a temporary Ingress or HTTPRoute, the service of the certificate isn't changed.
+type route struct {
+	// resolver manages the shared resolver behind the resolver service
+	resolver *kubernetes
+	svc      *corev1.Service
+	cfg      *v1alpha1.ACMEHTTP01Solver
+}
+
+func newRoute(e *kubernetes, cfg *v1alpha1.ACMEHTTP01Solver) *route {
+	resolver := newKubernetes(e.ctx, e.Client, e.log, &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+		Name:      resolverServiceName,
+		Namespace: e.svc.Namespace,
+	}}, challengeTypeHTTP01, httpPort)
+	resolver.mode = v1alpha1.SolverModeEndpointSlice
+	resolver.selfCheckMode = e.selfCheckMode
+	resolver.podTemplate = e.podTemplate
+	return &route{resolver: resolver, svc: e.svc, cfg: cfg}
+}
+
+// Present adds the challenge to the shared resolver and routes the challenge path of the domain to it.
+func (r *route) Present(domain, token, keyAuth string) error {
+	e := r.resolver
+	ch := apiChallenge{Domain: domain, Token: token}
+	e.presented[ch] = struct{}{}
+	if err := r.ensureResolverService(); err != nil {
+		return presentFailed(r, e.log, err, domain, token, keyAuth)
+	}
+	pod, err := e.startResolver()
+	if err == nil {
+		err = e.poll(pod, e.resolverServed)
+	}
+	if err != nil {
+		return presentFailed(r, e.log, err, domain, token, keyAuth)
+	}
+	ch.KeyAuthorization = keyAuth
+	if err := e.updateChallenge(pod, http.MethodPut, ch); err != nil {
+		return presentFailed(r, e.log, err, domain, token, keyAuth)
+	}
+	if err := r.createRoute(domain, token); err != nil {
+		return presentFailed(r, e.log, err, domain, token, keyAuth)
+	}
+	if err := e.selfCheck(domain, token, keyAuth); err != nil {
+		return presentFailed(r, e.log, err, domain, token, keyAuth)
+	}
+	return nil
+}
+
+// CleanUp removes the route and the challenge of the resolver.
+func (r *route) CleanUp(domain, token, keyAuth string) error {
+	e := r.resolver
+	ch := apiChallenge{Domain: domain, Token: token}
+	delete(e.presented, ch)
+	if err := r.deleteRoutes(client.MatchingLabels{challengeLabelKey: challengeHash(domain, token)}); err != nil {
+		e.log.Info("can't delete challenge route", "error", err)
+		return err
+	}
+	pod, err := e.findResolver()
+	if err != nil {
+		return err
+	}
+	if pod != nil && pod.Status.PodIP != "" {
+		if err := e.updateChallenge(pod, http.MethodDelete, ch); err != nil {
+			e.log.Info("can't remove challenge from resolver", "error", err)
+		}
+	}
+	if len(e.presented) > 0 {
+		return nil
+	}
+	return client.IgnoreNotFound(e.unmarkChallenge())
+}
+
+// ensureResolverService creates the service of the shared resolver and marks it as serving a challenge,
+// so the shared resolver isn't removed by the Sweeper.
+func (r *route) ensureResolverService() error {
+	e := r.resolver
+	_, err := controllerutil.CreateOrUpdate(e.ctx, e.Client, e.svc, func() error {
+		if e.svc.Labels == nil {
+			e.svc.Labels = map[string]string{}
+		}
+		e.svc.Labels[managedByLabelKey] = endpointSliceManagedBy
+		e.svc.Spec.Selector = e.resolverLabels()
+		e.svc.Spec.Ports = []corev1.ServicePort{{
+			Name:       resolverServicePort,
+			Port:       httpPort,
+			Protocol:   corev1.ProtocolTCP,
+			TargetPort: intstr.FromString(acmeHTTPPortName),
+		}}
+		markChallenge(e.svc)
+		return nil
+	})
+	return err
+}
+
+func (r *route) createRoute(domain, token string) error {
+	e := r.resolver
+	objMeta := metav1.ObjectMeta{
+		GenerateName: fmt.Sprintf("acme-%s-", r.svc.Name),
+		Namespace:    r.svc.Namespace,
+		Labels: map[string]string{
+			managedByLabelKey: endpointSliceManagedBy,
+			serviceLabelKey:   r.svc.Name,
+			challengeLabelKey: challengeHash(domain, token),
+		},
+	}
+	path := http01.ChallengePath(token)
+	if r.cfg.Mode == v1alpha1.SolverModeHTTPRoute {
+		return e.Create(e.ctx, r.httpRoute(objMeta, domain, path))
+	}
+	return e.Create(e.ctx, r.ingress(objMeta, domain, path))
+}
+
+func (r *route) ingress(objMeta metav1.ObjectMeta, domain, path string) *networkingv1.Ingress {
+	pathType := networkingv1.PathTypeExact
+	ing := &networkingv1.Ingress{
+		ObjectMeta: objMeta,
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{
+				Host: domain,
+				IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{{
+						Path:     path,
+						PathType: &pathType,
+						Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+							Name: resolverServiceName,
+							Port: networkingv1.ServiceBackendPort{Name: resolverServicePort},
+						}},
+					}},
+				}},
+			}},
+		},
+	}
+	if cfg := r.cfg.Ingress; cfg != nil {
+		ing.Annotations = cfg.Annotations
+		ing.Spec.IngressClassName = cfg.IngressClassName
+	}
+	return ing
+}
+
+func (r *route) httpRoute(objMeta metav1.ObjectMeta, domain, path string) *unstructured.Unstructured {
+	parentRefs := []interface{}{}
+	if cfg := r.cfg.HTTPRoute; cfg != nil {
+		for k, v := range cfg.Labels {
+			if _, ok := objMeta.Labels[k]; !ok {
+				objMeta.Labels[k] = v
+			}
+		}
+		for _, ref := range cfg.ParentRefs {
+			p := map[string]interface{}{"name": ref.Name}
+			if ref.Namespace != nil {
+				p["namespace"] = *ref.Namespace
+			}
+			if ref.SectionName != nil {
+				p["sectionName"] = *ref.SectionName
+			}
+			if ref.Port != nil {
+				p["port"] = int64(*ref.Port)
+			}
+			parentRefs = append(parentRefs, p)
+		}
+	}
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"parentRefs": parentRefs,
+			"hostnames":  []interface{}{domain},
+			"rules": []interface{}{map[string]interface{}{
+				"matches": []interface{}{map[string]interface{}{
+					"path": map[string]interface{}{"type": "Exact", "value": path},
+				}},
+				"backendRefs": []interface{}{map[string]interface{}{
+					"name": resolverServiceName,
+					"port": int64(httpPort),
+				}},
+			}},
+		},
+	}}
+	u.SetGroupVersionKind(httpRouteGVK)
+	u.SetGenerateName(objMeta.GenerateName)
+	u.SetNamespace(objMeta.Namespace)
+	u.SetLabels(objMeta.Labels)
+	return u
+}
+
+// deleteRoutes deletes the challenge routes of the service which match the labels.
+func (r *route) deleteRoutes(labels client.MatchingLabels) error {
+	e := r.resolver
+	opts := []client.DeleteAllOfOption{
+		client.InNamespace(r.svc.Namespace),
+		client.MatchingLabels{managedByLabelKey: endpointSliceManagedBy, serviceLabelKey: r.svc.Name},
+		labels,
+	}
+	if r.cfg.Mode == v1alpha1.SolverModeHTTPRoute {
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(httpRouteGVK)
+		return e.DeleteAllOf(e.ctx, u, opts...)
+	}
+	return e.DeleteAllOf(e.ctx, &networkingv1.Ingress{}, opts...)
+}
+
+// deleteOrphanedRoutes deletes the challenge routes which were created before the deadline.
+func deleteOrphanedRoutes(e *kubernetes, deadline metav1.Time) error {
+	matching := client.MatchingLabels{managedByLabelKey: endpointSliceManagedBy}
+	ingresses := &networkingv1.IngressList{}
+	if err := e.List(e.ctx, ingresses, matching); err != nil {
+		return err
+	}
+	for i := range ingresses.Items {
+		if ing := &ingresses.Items[i]; ing.CreationTimestamp.Before(&deadline) {
+			if err := e.Delete(e.ctx, ing); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+		}
+	}
+	routes := &unstructured.UnstructuredList{}
+	routes.SetGroupVersionKind(httpRouteGVK.GroupVersion().WithKind(httpRouteGVK.Kind + "List"))
+	if err := e.List(e.ctx, routes, matching); err != nil {
+		if meta.IsNoMatchError(err) || apierr.IsNotFound(err) {
+			// the Gateway API isn't installed
+			return nil
+		}
+		return err
+	}
+	for i := range routes.Items {
+		rt := &routes.Items[i]
+		if created := rt.GetCreationTimestamp(); created.Before(&deadline) {
+			if err := e.Delete(e.ctx, rt); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isResolverService returns whether the service is the service of the shared resolver.
+func isResolverService(svc *corev1.Service) bool {
+	return svc.Name == resolverServiceName && svc.Labels[managedByLabelKey] == endpointSliceManagedBy
+}
+
+func challengeHash(domain, token string) string {
+	sum := sha256.Sum256([]byte(domain + "/" + token))
+	return hex.EncodeToString(sum[:])[:16]
+}
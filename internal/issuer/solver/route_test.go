@@ -0,0 +1,105 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package solver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/onmetal/injector/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestIngressRoute(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "injector", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "nginx"}},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acmeresolver-abc",
+			Namespace: "default",
+			Labels:    map[string]string{resolverLabelKey: ResolverEnabled, sharedLabelKey: "true"},
+		},
+		Status: corev1.PodStatus{
+			PodIP:      "10.0.0.2",
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acme-resolver-xyz",
+			Namespace: "default",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: resolverServiceName},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints: []discoveryv1.Endpoint{
+			{Addresses: []string{"10.0.0.2"}, TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: pod.Name}},
+		},
+		Ports: []discoveryv1.EndpointPort{{Name: pointer.String(resolverServicePort)}},
+	}
+	c := fake.NewClientBuilder().WithObjects(svc, pod, slice).Build()
+	cfg := &v1alpha1.ACMEHTTP01Solver{
+		Mode:      v1alpha1.SolverModeIngress,
+		SelfCheck: v1alpha1.SelfCheckNone,
+		Ingress:   &v1alpha1.ACMEHTTP01Ingress{IngressClassName: pointer.String("nginx")},
+	}
+	r := New(ctx, c, logr.Discard(), svc, cfg, nil).(*route)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"challenges":1}`))
+	}))
+	defer api.Close()
+	r.resolver.resolverURL = func(*corev1.Pod) string { return api.URL }
+
+	a.NoError(r.Present("domain.com", "token", "key"))
+
+	resolverSvc := &corev1.Service{}
+	a.NoError(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: resolverServiceName}, resolverSvc))
+	a.Equal(map[string]string{resolverLabelKey: ResolverEnabled, sharedLabelKey: "true"}, resolverSvc.Spec.Selector)
+	a.Contains(resolverSvc.Annotations, challengeAnnotationKey)
+
+	ingresses := &networkingv1.IngressList{}
+	a.NoError(c.List(ctx, ingresses))
+	if a.Len(ingresses.Items, 1) {
+		ing := ingresses.Items[0]
+		a.Equal(pointer.String("nginx"), ing.Spec.IngressClassName)
+		a.Equal("domain.com", ing.Spec.Rules[0].Host)
+		path := ing.Spec.Rules[0].HTTP.Paths[0]
+		a.Equal("/.well-known/acme-challenge/token", path.Path)
+		a.Equal(resolverServiceName, path.Backend.Service.Name)
+	}
+	current := &corev1.Service{}
+	a.NoError(c.Get(ctx, client.ObjectKeyFromObject(svc), current))
+	a.Equal(map[string]string{"app": "nginx"}, current.Spec.Selector)
+	a.Empty(current.Annotations)
+
+	a.NoError(r.CleanUp("domain.com", "token", "key"))
+	a.NoError(c.List(ctx, ingresses))
+	a.Empty(ingresses.Items)
+	a.NoError(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: resolverServiceName}, resolverSvc))
+	a.NotContains(resolverSvc.Annotations, challengeAnnotationKey)
+	a.Equal(map[string]string{resolverLabelKey: ResolverEnabled, sharedLabelKey: "true"}, resolverSvc.Spec.Selector)
+}
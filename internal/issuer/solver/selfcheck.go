@@ -0,0 +1,104 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package solver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-acme/lego/v4/challenge/http01"
+	"github.com/onmetal/injector/api/v1alpha1"
+	injerr "github.com/onmetal/injector/internal/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	selfCheckTimeout         = 2 * time.Minute
+	selfCheckPollInterval    = 2 * time.Second
+	selfCheckRequestTimeout  = 5 * time.Second
+	maxKeyAuthorizationBytes = 1024
+)
+
+// selfCheck requests the token like the ACME server does and verifies the key authorization,
+// so failed validations don't count against the rate limit of the ACME server.
+func (e *kubernetes) selfCheck(domain, token, keyAuth string) error {
+	if e.challengeType != challengeTypeHTTP01 || e.selfCheckMode == v1alpha1.SelfCheckNone {
+		return nil
+	}
+	path := http01.ChallengePath(token)
+	urls := []string{fmt.Sprintf("http://%s%s", e.serviceAddress(), path)}
+	if e.selfCheckMode == v1alpha1.SelfCheckPublic {
+		urls = append(urls, fmt.Sprintf("http://%s%s", domain, path))
+	}
+	httpClient := &http.Client{Timeout: selfCheckRequestTimeout}
+
+	var lastErr error
+	err := wait.PollImmediateWithContext(e.ctx, selfCheckPollInterval, selfCheckTimeout, func(ctx context.Context) (bool, error) {
+		for _, u := range urls {
+			if lastErr = checkKeyAuthorization(ctx, httpClient, u, domain, keyAuth); lastErr != nil {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if errors.Is(err, wait.ErrWaitTimeout) && lastErr != nil {
+		return injerr.SelfCheckFailed(lastErr.Error())
+	}
+	if err != nil {
+		return injerr.SelfCheckFailed(err.Error())
+	}
+	e.log.Info("self check passed", "domain", domain, "urls", strings.Join(urls, ","))
+	return nil
+}
+
+// serviceAddress returns the in-cluster address of the service port the challenge is served on.
+func (e *kubernetes) serviceAddress() string {
+	host := e.svc.Spec.ClusterIP
+	if host == "" || host == "None" {
+		host = fmt.Sprintf("%s.%s.svc", e.svc.Name, e.svc.Namespace)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(e.port)))
+}
+
+func checkKeyAuthorization(ctx context.Context, httpClient *http.Client, url, domain, keyAuth string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	// the resolver only answers requests for the domain
+	req.Host = domain
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s of %s", resp.Status, url)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxKeyAuthorizationBytes))
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(body)) != keyAuth {
+		return fmt.Errorf("unexpected key authorization of %s", url)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package solver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/go-acme/lego/v4/challenge/http01"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSelfCheck(t *testing.T) {
+	a := assert.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "domain.com" || r.URL.Path != http01.ChallengePath("token") {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "token.key")
+	}))
+	defer srv.Close()
+	host, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	a.NoError(err)
+	p, err := strconv.Atoi(port)
+	a.NoError(err)
+
+	svc := &corev1.Service{Spec: corev1.ServiceSpec{ClusterIP: host}}
+	e := newKubernetes(context.Background(), nil, logr.Discard(), svc, challengeTypeHTTP01, int32(p))
+	a.NoError(e.selfCheck("domain.com", "token", "token.key"))
+
+	url := fmt.Sprintf("http://%s%s", e.serviceAddress(), http01.ChallengePath("token"))
+	a.Error(checkKeyAuthorization(context.Background(), srv.Client(), url, "domain.com", "other.key"))
+	a.Error(checkKeyAuthorization(context.Background(), srv.Client(), url, "other.com", "token.key"))
+}
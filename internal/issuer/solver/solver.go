@@ -15,12 +15,17 @@ package solver
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
-	"time"
+	"strconv"
 
-	"k8s.io/apimachinery/pkg/labels"
+	"github.com/onmetal/injector/api/v1alpha1"
+	injerr "github.com/onmetal/injector/internal/errors"
+	"k8s.io/apimachinery/pkg/util/intstr"
 
+	"github.com/go-acme/lego/v4/challenge"
 	"github.com/go-logr/logr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -32,11 +37,21 @@ const acmeHTTPResolver = "acmeresolver-"
 
 const defaultImage = "yotsyni/acmeresolver:latest"
 
-const waitForServiceSwitchSecond = 45 * time.Second
+const ResolverEnabled = "true"
+
+const resolverLabelKey = "acmesolver"
 
 const (
-	InjectAnnotationKey = "cert.injector.ko/issue"
-	ResolverEnabled     = "true"
+	unprivilegedPortStart = 1024
+	// defaultResolverPort is the port the resolver listens on for http-01 if the service has no port 80.
+	defaultResolverPort = 8080
+	httpPort            = 80
+)
+
+// Challenge types the resolver pod answers, see app/acmeresolver.
+const (
+	challengeTypeHTTP01    = "http-01"
+	challengeTypeTLSALPN01 = "tls-alpn-01"
 )
 
 type Provider interface {
@@ -51,87 +66,193 @@ type kubernetes struct {
 	log   logr.Logger
 	svc   *corev1.Service
 	image string
+
+	challengeType string
+	port          int32
+	selfCheckMode string
+	mode          string
+	podTemplate   *v1alpha1.ACMESolverPodTemplate
+
+	// resolverURL returns the address of the challenge api of the resolver pod
+	resolverURL func(pod *corev1.Pod) string
+	// presented are the challenges of the service which aren't cleaned up yet
+	presented map[apiChallenge]struct{}
+}
+
+// New returns the provider which solves http-01 challenges by a resolver pod behind the service.
+// The pod template is merged into the resolver pod.
+func New(ctx context.Context, c client.Client, l logr.Logger, svc *corev1.Service, cfg *v1alpha1.ACMEHTTP01Solver,
+	tmpl *v1alpha1.ACMESolverPodTemplate) Provider {
+	e := newKubernetes(ctx, c, l, svc, challengeTypeHTTP01, httpPort)
+	e.podTemplate = tmpl
+	if cfg != nil && cfg.SelfCheck != "" {
+		e.selfCheckMode = cfg.SelfCheck
+	}
+	if cfg != nil && cfg.Mode != "" {
+		e.mode = cfg.Mode
+	}
+	if e.mode == v1alpha1.SolverModeIngress || e.mode == v1alpha1.SolverModeHTTPRoute {
+		return newRoute(e, cfg)
+	}
+	return e
 }
 
-func New(ctx context.Context, c client.Client, l logr.Logger, svc *corev1.Service) Provider {
+// NewTLSALPN returns the provider which solves tls-alpn-01 challenges by a resolver pod
+// behind the port of the service.
+func NewTLSALPN(ctx context.Context, c client.Client, l logr.Logger, svc *corev1.Service, port int32,
+	tmpl *v1alpha1.ACMESolverPodTemplate) Provider {
+	e := newKubernetes(ctx, c, l, svc, challengeTypeTLSALPN01, port)
+	e.podTemplate = tmpl
+	return e
+}
+
+func newKubernetes(ctx context.Context, c client.Client, l logr.Logger, svc *corev1.Service,
+	challengeType string, port int32) *kubernetes {
 	image := defaultImage
 	if os.Getenv("RESOLVER_CUSTOM_IMAGE") != "" {
 		image = os.Getenv("RESOLVER_CUSTOM_IMAGE")
 	}
 	return &kubernetes{
-		Client: c,
-		ctx:    ctx,
-		log:    l,
-		svc:    svc,
-		image:  image,
+		Client:        c,
+		ctx:           ctx,
+		log:           l,
+		svc:           svc,
+		image:         image,
+		challengeType: challengeType,
+		port:          port,
+		selfCheckMode: v1alpha1.SelfCheckService,
+		mode:          v1alpha1.SolverModeSelector,
+		resolverURL:   podAPIURL,
+		presented:     map[apiChallenge]struct{}{},
 	}
 }
 
+// Present adds the challenge to the resolver of the service, the resolver is started if the service has none.
 func (e *kubernetes) Present(domain, token, keyAuth string) error {
-	if err := e.changeServiceSelector(); err != nil {
-		return err
+	ch := apiChallenge{Domain: domain, Token: token}
+	e.presented[ch] = struct{}{}
+	pod, err := e.ensureResolver()
+	if err != nil {
+		return presentFailed(e, e.log, err, domain, token, keyAuth)
 	}
-	pod := e.preparePod(domain, token, keyAuth)
-	if err := e.Create(e.ctx, pod); err != nil {
-		return err
+	ch.KeyAuthorization = keyAuth
+	if err := e.updateChallenge(pod, http.MethodPut, ch); err != nil {
+		return presentFailed(e, e.log, err, domain, token, keyAuth)
+	}
+	if err := e.selfCheck(domain, token, keyAuth); err != nil {
+		return presentFailed(e, e.log, err, domain, token, keyAuth)
 	}
-	time.Sleep(waitForServiceSwitchSecond)
 	return nil
 }
 
+// presentFailed cleans up the challenge of the provider which failed to be presented and returns the error,
+// lego doesn't clean up challenges which failed to be presented.
+func presentFailed(p challenge.Provider, l logr.Logger, err error, domain, token, keyAuth string) error {
+	l.Info("resolver isn't serving the challenge", "error", err)
+	if cleanUpErr := p.CleanUp(domain, token, keyAuth); cleanUpErr != nil {
+		l.Info("can't clean up challenge", "error", cleanUpErr)
+	}
+	return err
+}
+
 func (e *kubernetes) changeServiceSelector() error {
-	e.svc.Spec.Selector["acmesolver"] = ResolverEnabled
+	e.svc.Spec.Selector[resolverLabelKey] = ResolverEnabled
+	markChallenge(e.svc)
 	return e.Client.Update(e.ctx, e.svc)
 }
 
-func (e *kubernetes) preparePod(domain, token, keyAuth string) *corev1.Pod {
-	return &corev1.Pod{
+func (e *kubernetes) preparePod() (*corev1.Pod, error) {
+	podLabels := e.resolverLabels()
+	if !e.shared() {
+		for k, v := range e.svc.Spec.Selector {
+			podLabels[k] = v
+		}
+	}
+	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			GenerateName: acmeHTTPResolver, Namespace: e.svc.Namespace, Labels: e.svc.Spec.Selector,
+			GenerateName: acmeHTTPResolver, Namespace: e.svc.Namespace, Labels: podLabels,
 		},
 		Spec: corev1.PodSpec{
 			Containers: []corev1.Container{
-				{Name: "test", Image: e.image, Env: []corev1.EnvVar{
-					{Name: "DOMAIN_NAME", Value: domain},
-					{Name: "TOKEN", Value: token},
-					{Name: "AUTH_KEY", Value: keyAuth},
+				{Name: "acmeresolver", Image: e.image, SecurityContext: defaultContainerSecurityContext(), Env: []corev1.EnvVar{
+					{Name: "CHALLENGE_TYPE", Value: e.challengeType},
+					{Name: apiPortEnv, Value: strconv.Itoa(apiPort)},
+					{Name: apiTokenEnv, ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: apiTokenSecretName},
+						Key:                  apiTokenKey,
+					}}},
 				}},
 			},
 			RestartPolicy: "Always",
 		},
 	}
+	e.ownResolverPod(pod)
+	port, err := e.targetPort()
+	switch {
+	case e.shared():
+		// the endpoint slices route to any port of the pod
+		port, err = corev1.ContainerPort{Name: acmeHTTPPortName, ContainerPort: defaultResolverPort, Protocol: corev1.ProtocolTCP}, nil
+	case err == nil:
+	case injerr.IsNotExist(err) && e.challengeType == challengeTypeHTTP01:
+		port = corev1.ContainerPort{ContainerPort: defaultResolverPort, Protocol: corev1.ProtocolTCP}
+	default:
+		return nil, err
+	}
+	container := &pod.Spec.Containers[0]
+	container.Ports = []corev1.ContainerPort{port}
+	container.Env = append(container.Env, corev1.EnvVar{Name: "PORT", Value: strconv.Itoa(int(port.ContainerPort))})
+	container.ReadinessProbe = &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(int(port.ContainerPort))},
+		},
+		PeriodSeconds: 1,
+	}
+	if port.ContainerPort < unprivilegedPortStart {
+		// the resolver image runs as non-root user
+		pod.Spec.SecurityContext = &corev1.PodSecurityContext{Sysctls: []corev1.Sysctl{
+			{Name: unprivilegedPortSysctl, Value: "0"},
+		}}
+	}
+	e.applyPodTemplate(pod)
+	return pod, nil
+}
+
+// targetPort returns the container port the service forwards the challenge port to.
+func (e *kubernetes) targetPort() (corev1.ContainerPort, error) {
+	for _, p := range e.svc.Spec.Ports {
+		if p.Port != e.port {
+			continue
+		}
+		port := corev1.ContainerPort{ContainerPort: p.TargetPort.IntVal, Protocol: corev1.ProtocolTCP}
+		switch {
+		case p.TargetPort.Type == intstr.String:
+			port.Name = p.TargetPort.StrVal
+			port.ContainerPort = p.Port
+		case p.TargetPort.IntVal == 0:
+			port.ContainerPort = p.Port
+		}
+		return port, nil
+	}
+	return corev1.ContainerPort{}, injerr.NotExist(fmt.Sprintf("port %d of service %s", e.port, e.svc.Name))
 }
 
+// CleanUp removes the challenge from the resolver. The service is switched back to the application
+// once all of its challenges are cleaned up.
 func (e *kubernetes) CleanUp(domain, token, keyAuth string) error {
 	log.Println("clean up process started")
-
-	pods := &corev1.PodList{}
-	filter := &client.ListOptions{
-		LabelSelector: client.MatchingLabelsSelector{
-			Selector: labels.SelectorFromSet(e.svc.Spec.Selector),
-		},
-	}
-	if err := e.List(e.ctx, pods, filter); err != nil {
-		e.log.Info("can't list pods with labels", "error", err)
+	ch := apiChallenge{Domain: domain, Token: token}
+	delete(e.presented, ch)
+	pod, err := e.findResolver()
+	if err != nil {
 		return err
 	}
-	if len(pods.Items) == 0 {
-		e.log.Info("no pods for deletion found")
-		return e.reverseServiceSelector()
-	}
-	if err := e.Delete(e.ctx, &pods.Items[0]); err != nil {
-		e.log.Info("can't delete acme resolver pod", "error", err)
-		return err
+	if pod != nil && pod.Status.PodIP != "" {
+		if err := e.updateChallenge(pod, http.MethodDelete, ch); err != nil {
+			e.log.Info("can't remove challenge from resolver", "error", err)
+		}
 	}
-	return e.reverseServiceSelector()
-}
-
-func (e *kubernetes) reverseServiceSelector() error {
-	e.svc.ObjectMeta.Annotations[InjectAnnotationKey] = "done"
-	_, ok := e.svc.Spec.Selector["acmesolver"]
-	if ok {
-		delete(e.svc.Spec.Selector, "acmesolver")
+	if len(e.presented) > 0 {
+		return nil
 	}
-	e.log.Info("reverting service labels")
-	return e.Client.Update(e.ctx, e.svc)
+	return e.cleanUp()
 }
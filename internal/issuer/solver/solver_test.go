@@ -0,0 +1,128 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package solver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/onmetal/injector/api/v1alpha1"
+	injerr "github.com/onmetal/injector/internal/errors"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/pointer"
+)
+
+func TestPrepareTLSALPNPod(t *testing.T) {
+	a := assert.New(t)
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "injector", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": "nginx"},
+			Ports: []corev1.ServicePort{
+				{Name: "http", Port: 80, TargetPort: intstr.FromInt(8080)},
+				{Name: "https", Port: 443, TargetPort: intstr.FromString("https")},
+			},
+		},
+	}
+
+	e := newKubernetes(context.Background(), nil, logr.Discard(), svc, challengeTypeTLSALPN01, 443)
+	pod, err := e.preparePod()
+	a.NoError(err)
+	container := pod.Spec.Containers[0]
+	a.Equal([]corev1.ContainerPort{{Name: "https", ContainerPort: 443, Protocol: corev1.ProtocolTCP}}, container.Ports)
+	a.Contains(container.Env, corev1.EnvVar{Name: "CHALLENGE_TYPE", Value: challengeTypeTLSALPN01})
+	a.Contains(container.Env, corev1.EnvVar{Name: "PORT", Value: "443"})
+	a.NotNil(pod.Spec.SecurityContext)
+
+	svc.Spec.Ports[1].TargetPort = intstr.FromInt(8443)
+	pod, err = e.preparePod()
+	a.NoError(err)
+	a.Contains(pod.Spec.Containers[0].Env, corev1.EnvVar{Name: "PORT", Value: "8443"})
+	a.Nil(pod.Spec.SecurityContext)
+
+	svc.Spec.Ports = svc.Spec.Ports[:1]
+	_, err = e.preparePod()
+	a.True(injerr.IsNotExist(err))
+}
+
+func TestPrepareHTTPPod(t *testing.T) {
+	a := assert.New(t)
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "injector", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": "nginx"},
+			Ports:    []corev1.ServicePort{{Name: "http", Port: 80, TargetPort: intstr.FromInt(8000)}},
+		},
+	}
+
+	e := newKubernetes(context.Background(), nil, logr.Discard(), svc, challengeTypeHTTP01, httpPort)
+	pod, err := e.preparePod()
+	a.NoError(err)
+	a.Equal(map[string]string{"app": "nginx", resolverLabelKey: ResolverEnabled, serviceLabelKey: "injector"}, pod.Labels)
+	a.Equal(map[string]string{"app": "nginx"}, svc.Spec.Selector)
+	a.Contains(pod.Spec.Containers[0].Env, corev1.EnvVar{Name: "PORT", Value: "8000"})
+	a.Equal(intstr.FromInt(8000), pod.Spec.Containers[0].ReadinessProbe.TCPSocket.Port)
+
+	svc.Spec.Ports[0].Port = 8080
+	pod, err = e.preparePod()
+	a.NoError(err)
+	a.Contains(pod.Spec.Containers[0].Env, corev1.EnvVar{Name: "PORT", Value: "8080"})
+}
+
+func TestPodTemplate(t *testing.T) {
+	a := assert.New(t)
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "injector", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": "nginx"},
+			Ports:    []corev1.ServicePort{{Name: "http", Port: 80, TargetPort: intstr.FromString("http")}},
+		},
+	}
+	tmpl := &v1alpha1.ACMESolverPodTemplate{
+		Metadata: &v1alpha1.ACMESolverPodObjectMeta{
+			Labels:      map[string]string{"team": "web", resolverLabelKey: "false"},
+			Annotations: map[string]string{"sidecar.istio.io/inject": "false"},
+		},
+		Spec: &v1alpha1.ACMESolverPodSpec{
+			Image:              "registry.local/acmeresolver:v1",
+			ImagePullSecrets:   []corev1.LocalObjectReference{{Name: "registry"}},
+			NodeSelector:       map[string]string{"kubernetes.io/os": "linux"},
+			Tolerations:        []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}},
+			PriorityClassName:  "low",
+			ServiceAccountName: "acmeresolver",
+			SecurityContext:    &corev1.PodSecurityContext{RunAsNonRoot: pointer.Bool(true)},
+		},
+	}
+
+	e := New(context.Background(), nil, logr.Discard(), svc, nil, tmpl).(*kubernetes)
+	pod, err := e.preparePod()
+	a.NoError(err)
+	a.Equal("web", pod.Labels["team"])
+	a.Equal(ResolverEnabled, pod.Labels[resolverLabelKey])
+	a.Equal(map[string]string{"sidecar.istio.io/inject": "false"}, pod.Annotations)
+	container := pod.Spec.Containers[0]
+	a.Equal("registry.local/acmeresolver:v1", container.Image)
+	a.Equal(defaultContainerSecurityContext(), container.SecurityContext)
+	a.Equal([]corev1.LocalObjectReference{{Name: "registry"}}, pod.Spec.ImagePullSecrets)
+	a.Equal(map[string]string{"kubernetes.io/os": "linux"}, pod.Spec.NodeSelector)
+	a.Len(pod.Spec.Tolerations, 1)
+	a.Equal("low", pod.Spec.PriorityClassName)
+	a.Equal("acmeresolver", pod.Spec.ServiceAccountName)
+	a.Equal(pointer.Bool(true), pod.Spec.SecurityContext.RunAsNonRoot)
+	a.Equal([]corev1.Sysctl{{Name: unprivilegedPortSysctl, Value: "0"}}, pod.Spec.SecurityContext.Sysctls)
+}
@@ -0,0 +1,136 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package solver
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	defaultSweepInterval = 5 * time.Minute
+	// defaultMaxChallengeAge is longer than a challenge takes to be presented, checked and validated.
+	defaultMaxChallengeAge = 15 * time.Minute
+)
+
+// Sweeper reverts services and removes resolver pods which are left behind by challenges
+// that weren't cleaned up, e.g. because the controller died while the challenge was solved.
+// Resolvers shared by a namespace are removed once no service of the namespace has a challenge.
+// It runs on start and periodically afterwards.
+type Sweeper struct {
+	client.Client
+
+	// Interval between sweeps, defaults to 5 minutes.
+	Interval time.Duration
+	// MaxChallengeAge after which a challenge is considered orphaned, defaults to 15 minutes.
+	MaxChallengeAge time.Duration
+}
+
+// Start implements manager.Runnable.
+func (s *Sweeper) Start(ctx context.Context) error {
+	interval := s.Interval
+	if interval == 0 {
+		interval = defaultSweepInterval
+	}
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := s.Sweep(ctx); err != nil {
+			log.FromContext(ctx).Info("can't sweep acme resolvers", "error", err)
+		}
+	}, interval)
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, only the leader solves challenges.
+func (s *Sweeper) NeedLeaderElection() bool {
+	return true
+}
+
+// Sweep reverts the orphaned challenges of services and removes orphaned resolver pods.
+func (s *Sweeper) Sweep(ctx context.Context) error {
+	l := log.FromContext(ctx).WithName("sweeper")
+	maxAge := s.MaxChallengeAge
+	if maxAge == 0 {
+		maxAge = defaultMaxChallengeAge
+	}
+	deadline := time.Now().Add(-maxAge)
+
+	services := &corev1.ServiceList{}
+	if err := s.List(ctx, services); err != nil {
+		return err
+	}
+	active := map[client.ObjectKey]bool{}
+	activeNamespaces := map[string]bool{}
+	for i := range services.Items {
+		svc := &services.Items[i]
+		started, ok := challengeStarted(svc)
+		resolverService := isResolverService(svc)
+		if resolverService {
+			// the service of the shared resolver selects it, only its mark is orphaned
+			_, ok = svc.Annotations[challengeAnnotationKey]
+		}
+		if !ok {
+			continue
+		}
+		if started.After(deadline) {
+			active[client.ObjectKeyFromObject(svc)] = true
+			activeNamespaces[svc.Namespace] = true
+			continue
+		}
+		l.Info("reverting orphaned challenge", "service", svc.Name, "namespace", svc.Namespace)
+		e := s.solverFor(ctx, l, svc)
+		if resolverService {
+			if err := e.unmarkChallenge(); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			continue
+		}
+		if err := e.cleanUp(); err != nil {
+			return err
+		}
+	}
+	if err := deleteOrphanedRoutes(s.solverFor(ctx, l, &corev1.Service{}), metav1.NewTime(deadline)); err != nil {
+		return err
+	}
+
+	pods := &corev1.PodList{}
+	if err := s.List(ctx, pods, client.MatchingLabels{resolverLabelKey: ResolverEnabled}); err != nil {
+		return err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		key := client.ObjectKey{Namespace: pod.Namespace, Name: pod.Labels[serviceLabelKey]}
+		if active[key] || (pod.Labels[sharedLabelKey] != "" && activeNamespaces[pod.Namespace]) ||
+			(pod.DeletionTimestamp == nil && pod.CreationTimestamp.After(deadline)) {
+			continue
+		}
+		l.Info("removing orphaned resolver pod", "pod", pod.Name, "namespace", pod.Namespace)
+		svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}}
+		if err := s.solverFor(ctx, l, svc).deleteResolverPod(pod); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Sweeper) solverFor(ctx context.Context, l logr.Logger, svc *corev1.Service) *kubernetes {
+	// only HTTP-01 challenges change the ports of the service
+	return newKubernetes(ctx, s.Client, l, svc, challengeTypeHTTP01, httpPort)
+}
@@ -0,0 +1,82 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package solver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSweep(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	orphaned := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "orphaned", Namespace: "default", Annotations: map[string]string{
+			challengeAnnotationKey:  time.Now().Add(-time.Hour).UTC().Format(time.RFC3339),
+			targetPortAnnotationKey: "8000",
+		}},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": "nginx", resolverLabelKey: ResolverEnabled},
+			Ports:    []corev1.ServicePort{{Name: "http", Port: 80, TargetPort: intstr.FromString(acmeHTTPPortName)}},
+		},
+	}
+	active := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "active", Namespace: "default", Annotations: map[string]string{
+			challengeAnnotationKey: time.Now().UTC().Format(time.RFC3339),
+		}},
+		Spec: corev1.ServiceSpec{Selector: map[string]string{"app": "web", resolverLabelKey: ResolverEnabled}},
+	}
+	resolverPod := func(name, svc string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:       name,
+			Namespace:  "default",
+			Labels:     map[string]string{resolverLabelKey: ResolverEnabled, serviceLabelKey: svc},
+			Finalizers: []string{resolverFinalizer},
+		}}
+	}
+	c := fake.NewClientBuilder().WithObjects(orphaned, active,
+		resolverPod("acmeresolver-orphaned", "orphaned"),
+		resolverPod("acmeresolver-active", "active"),
+		resolverPod("acmeresolver-deleted", "deleted"),
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:      "acmeresolver-shared",
+			Namespace: "default",
+			Labels:    map[string]string{resolverLabelKey: ResolverEnabled, sharedLabelKey: "true"},
+		}},
+	).Build()
+
+	a.NoError((&Sweeper{Client: c}).Sweep(ctx))
+
+	svc := &corev1.Service{}
+	a.NoError(c.Get(ctx, client.ObjectKeyFromObject(orphaned), svc))
+	a.Equal(map[string]string{"app": "nginx"}, svc.Spec.Selector)
+	a.Equal(intstr.FromInt(8000), svc.Spec.Ports[0].TargetPort)
+	a.Empty(svc.Annotations)
+	a.NoError(c.Get(ctx, client.ObjectKeyFromObject(active), svc))
+	a.Contains(svc.Spec.Selector, resolverLabelKey)
+
+	pods := &corev1.PodList{}
+	a.NoError(c.List(ctx, pods))
+	a.Len(pods.Items, 2)
+	a.Equal("acmeresolver-active", pods.Items[0].Name)
+	a.Equal("acmeresolver-shared", pods.Items[1].Name)
+}
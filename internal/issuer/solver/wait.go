@@ -0,0 +1,125 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package solver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/onmetal/injector/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	resolverReadyTimeout = 3 * time.Minute
+	resolverPollInterval = 2 * time.Second
+)
+
+// failedWaitingReasons are reasons of waiting containers which don't resolve without intervention.
+var failedWaitingReasons = map[string]struct{}{
+	"ErrImagePull":               {},
+	"ImagePullBackOff":           {},
+	"InvalidImageName":           {},
+	"CrashLoopBackOff":           {},
+	"CreateContainerConfigError": {},
+}
+
+// resolverCheck returns whether the resolver pod is in the expected state, or the reason why it isn't.
+type resolverCheck func(ctx context.Context, pod *corev1.Pod) (bool, string, error)
+
+// poll waits until the check of the resolver pod succeeds.
+func (e *kubernetes) poll(pod *corev1.Pod, check resolverCheck) error {
+	var reason string
+	err := wait.PollImmediateWithContext(e.ctx, resolverPollInterval, resolverReadyTimeout, func(ctx context.Context) (bool, error) {
+		var ok bool
+		var err error
+		ok, reason, err = check(ctx, pod)
+		return ok, err
+	})
+	if errors.Is(err, wait.ErrWaitTimeout) {
+		return fmt.Errorf("resolver pod %s isn't serving after %s: %s", pod.Name, resolverReadyTimeout, reason)
+	}
+	if err != nil {
+		return fmt.Errorf("resolver pod %s failed: %w", pod.Name, err)
+	}
+	return nil
+}
+
+// resolverReady returns whether the pod is ready, it fails for containers which won't start.
+func (e *kubernetes) resolverReady(ctx context.Context, pod *corev1.Pod) (bool, string, error) {
+	current := &corev1.Pod{}
+	if err := e.Get(ctx, client.ObjectKeyFromObject(pod), current); err != nil {
+		return false, "", err
+	}
+	for _, cs := range current.Status.ContainerStatuses {
+		if w := cs.State.Waiting; w != nil {
+			if _, ok := failedWaitingReasons[w.Reason]; ok {
+				return false, "", fmt.Errorf("container %s is waiting: %s: %s", cs.Name, w.Reason, w.Message)
+			}
+		}
+	}
+	for _, c := range current.Status.Conditions {
+		if c.Type == corev1.PodReady && c.Status == corev1.ConditionTrue {
+			return true, "", nil
+		}
+	}
+	return false, fmt.Sprintf("pod isn't ready, phase %s", current.Status.Phase), nil
+}
+
+// resolverServed returns whether the pod is the only ready endpoint of the challenge port of the service.
+func (e *kubernetes) resolverServed(ctx context.Context, pod *corev1.Pod) (bool, string, error) {
+	slices := &discoveryv1.EndpointSliceList{}
+	if err := e.List(ctx, slices, client.InNamespace(e.svc.Namespace),
+		client.MatchingLabels{discoveryv1.LabelServiceName: e.svc.Name}); err != nil {
+		return false, "", err
+	}
+	var resolver, others int
+	for _, slice := range slices.Items {
+		if e.mode == v1alpha1.SolverModeEndpointSlice && !hasPort(slice.Ports, e.challengePortName()) {
+			continue
+		}
+		for _, ep := range slice.Endpoints {
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+			if ep.TargetRef != nil && ep.TargetRef.Kind == "Pod" && ep.TargetRef.Name == pod.Name {
+				resolver++
+				continue
+			}
+			others++
+		}
+	}
+	switch {
+	case resolver == 0:
+		return false, fmt.Sprintf("pod isn't an endpoint of service %s", e.svc.Name), nil
+	case others > 0:
+		return false, fmt.Sprintf("service %s has %d other endpoints", e.svc.Name, others), nil
+	}
+	e.log.Info("resolver is serving the challenge", "pod", pod.Name)
+	return true, "", nil
+}
+
+func hasPort(ports []discoveryv1.EndpointPort, name string) bool {
+	for _, p := range ports {
+		if p.Name != nil && *p.Name == name {
+			return true
+		}
+	}
+	return false
+}
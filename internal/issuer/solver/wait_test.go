@@ -0,0 +1,90 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package solver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestResolverReady(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "acmeresolver-abc", Namespace: "default"},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "test",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}},
+		}}},
+	}
+	c := fake.NewClientBuilder().WithObjects(pod).Build()
+	e := newKubernetes(ctx, c, logr.Discard(), &corev1.Service{}, challengeTypeHTTP01, httpPort)
+
+	ready, reason, err := e.resolverReady(ctx, pod)
+	a.NoError(err)
+	a.False(ready)
+	a.NotEmpty(reason)
+
+	pod.Status.ContainerStatuses[0].State.Waiting.Reason = "ImagePullBackOff"
+	a.NoError(c.Update(ctx, pod))
+	_, _, err = e.resolverReady(ctx, pod)
+	a.Error(err)
+
+	pod.Status.ContainerStatuses[0].State = corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	a.NoError(c.Update(ctx, pod))
+	ready, _, err = e.resolverReady(ctx, pod)
+	a.NoError(err)
+	a.True(ready)
+}
+
+func TestResolverServed(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "injector", Namespace: "default"}}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "acmeresolver-abc", Namespace: "default"}}
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "injector-xyz",
+			Namespace: "default",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: svc.Name},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints: []discoveryv1.Endpoint{
+			{Addresses: []string{"10.0.0.1"}, TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "nginx"}},
+			{Addresses: []string{"10.0.0.2"}, TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: pod.Name}},
+		},
+	}
+	c := fake.NewClientBuilder().WithObjects(slice).Build()
+	e := newKubernetes(ctx, c, logr.Discard(), svc, challengeTypeHTTP01, httpPort)
+
+	served, reason, err := e.resolverServed(ctx, pod)
+	a.NoError(err)
+	a.False(served)
+	a.Contains(reason, "1 other endpoints")
+
+	slice.Endpoints[0].Conditions.Ready = pointer.Bool(false)
+	a.NoError(c.Update(ctx, slice))
+	served, _, err = e.resolverServed(ctx, pod)
+	a.NoError(err)
+	a.True(served)
+}
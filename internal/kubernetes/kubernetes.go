@@ -16,7 +16,9 @@ package kubernetes
 import (
 	"context"
 
+	"github.com/onmetal/injector/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 
 	"github.com/go-acme/lego/v4/certificate"
 	"github.com/go-logr/logr"
@@ -27,27 +29,28 @@ import (
 type Kubernetes struct {
 	client.Client
 
-	ctx                   context.Context
-	log                   logr.Logger
-	cert                  *certificate.Resource
-	req                   ctrl.Request
-	selector, annotations map[string]string
+	ctx  context.Context
+	log  logr.Logger
+	cert *certificate.Resource
+	crt  *v1alpha1.Certificate
+	// ca is the CA bundle which is stored with the certificate
+	ca []byte
 }
 
-func New(ctx context.Context, c client.Client, l logr.Logger, cert *certificate.Resource, req ctrl.Request) (*Kubernetes, error) {
-	s, err := GetService(ctx, c, req)
-	if err != nil {
-		return nil, err
-	}
+func New(ctx context.Context, c client.Client, l logr.Logger, cert *certificate.Resource, crt *v1alpha1.Certificate) *Kubernetes {
 	return &Kubernetes{
-		Client:      c,
-		ctx:         ctx,
-		log:         l,
-		cert:        cert,
-		req:         req,
-		annotations: s.Annotations,
-		selector:    s.Spec.Selector,
-	}, nil
+		Client: c,
+		ctx:    ctx,
+		log:    l,
+		cert:   cert,
+		crt:    crt,
+	}
+}
+
+// WithCABundle stores the CA bundle with the certificate.
+func (k *Kubernetes) WithCABundle(ca []byte) *Kubernetes {
+	k.ca = ca
+	return k
 }
 
 func GetService(ctx context.Context, c client.Client, req ctrl.Request) (*corev1.Service, error) {
@@ -55,3 +58,12 @@ func GetService(ctx context.Context, c client.Client, req ctrl.Request) (*corev1
 	err := c.Get(ctx, req.NamespacedName, s)
 	return s, err
 }
+
+// GetCertificateService returns the service which solves challenges for the certificate.
+func GetCertificateService(ctx context.Context, c client.Client, crt *v1alpha1.Certificate) (*corev1.Service, error) {
+	req := ctrl.Request{NamespacedName: types.NamespacedName{
+		Namespace: crt.Namespace,
+		Name:      crt.Spec.ServiceName,
+	}}
+	return GetService(ctx, c, req)
+}
@@ -0,0 +1,264 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/onmetal/injector/api/v1alpha1"
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// Keys of the additional outputs in the secret of a certificate.
+const (
+	PKCS12KeystoreKey   = "keystore.p12"
+	PKCS12TruststoreKey = "truststore.p12"
+	JKSKeystoreKey      = "keystore.jks"
+	JKSTruststoreKey    = "truststore.jks"
+	CombinedPEMKey      = "tls-combined.pem"
+	CertificateDERKey   = "tls.der"
+	PrivateKeyDERKey    = "key.der"
+)
+
+// outputKeys are the keys of the keystores and additional output formats in the secret.
+var outputKeys = []string{
+	PKCS12KeystoreKey, PKCS12TruststoreKey, JKSKeystoreKey, JKSTruststoreKey,
+	CombinedPEMKey, CertificateDERKey, PrivateKeyDERKey,
+}
+
+const (
+	defaultPasswordKey = "password"
+	// keystoreAlias is the alias of the certificate in JKS keystores.
+	keystoreAlias = "certificate"
+)
+
+// keyPair is the parsed certificate chain and private key.
+type keyPair struct {
+	chain []*x509.Certificate
+	ca    []*x509.Certificate
+	key   interface{}
+	// pkcs8 is the DER encoded private key
+	pkcs8 []byte
+}
+
+// OutputsHashAnnotationKey is the hash of the inputs of the keystores and additional output formats in the secret.
+const OutputsHashAnnotationKey = "cert.injector.ko/outputs-hash"
+
+// ValidateOutputs checks the keystores and additional output formats of the certificate and reads the keystore
+// passwords. It's called before the certificate is ordered, a certificate which can't be stored isn't ordered.
+func ValidateOutputs(ctx context.Context, c client.Client, crt *v1alpha1.Certificate) error {
+	if !hasOutputs(crt) {
+		return nil
+	}
+	if crt.Spec.CSR != nil {
+		return errOutputsRequireKey
+	}
+	_, err := keystorePasswords(ctx, c, crt)
+	return err
+}
+
+var errOutputsRequireKey = fmt.Errorf("keystores and additional output formats require the private key of the certificate")
+
+func hasOutputs(crt *v1alpha1.Certificate) bool {
+	return crt.Spec.Keystores != nil || len(crt.Spec.AdditionalOutputFormats) != 0
+}
+
+// addOutputs adds the keystores and additional output formats of the certificate to the secret data and returns
+// the hash of their inputs, empty if there are none. The outputs of the current secret data are kept if they have
+// the same hash, the keystores are encrypted with random salts and would change the secret on every reconciliation.
+func (k *Kubernetes) addOutputs(data map[string][]byte, current *corev1.Secret) (string, error) {
+	spec := k.crt.Spec
+	if !hasOutputs(k.crt) {
+		return "", nil
+	}
+	if len(k.cert.PrivateKey) == 0 {
+		return "", errOutputsRequireKey
+	}
+	passwords, err := keystorePasswords(k.ctx, k.Client, k.crt)
+	if err != nil {
+		return "", err
+	}
+	hash, err := k.outputsHash(passwords)
+	if err != nil {
+		return "", err
+	}
+	if current != nil && current.Annotations[OutputsHashAnnotationKey] == hash {
+		for _, key := range outputKeys {
+			if v, ok := current.Data[key]; ok {
+				data[key] = v
+			}
+		}
+		return hash, nil
+	}
+	kp, err := k.parseKeyPair()
+	if err != nil {
+		return "", err
+	}
+	for _, f := range spec.AdditionalOutputFormats {
+		switch f.Type {
+		case v1alpha1.OutputFormatCombinedPEM:
+			data[CombinedPEMKey] = append(append([]byte{}, k.cert.PrivateKey...), k.cert.Certificate...)
+		case v1alpha1.OutputFormatDER:
+			data[CertificateDERKey] = kp.chain[0].Raw
+			data[PrivateKeyDERKey] = kp.pkcs8
+		}
+	}
+	if password, ok := passwords[PKCS12KeystoreKey]; ok {
+		if data[PKCS12KeystoreKey], err = pkcs12.Encode(rand.Reader, kp.key, kp.chain[0], kp.chain[1:], password); err != nil {
+			return "", err
+		}
+		if len(kp.ca) != 0 {
+			if data[PKCS12TruststoreKey], err = pkcs12.EncodeTrustStore(rand.Reader, kp.ca, password); err != nil {
+				return "", err
+			}
+		}
+	}
+	if password, ok := passwords[JKSKeystoreKey]; ok {
+		if data[JKSKeystoreKey], err = kp.jksKeystore([]byte(password)); err != nil {
+			return "", err
+		}
+		if len(kp.ca) != 0 {
+			if data[JKSTruststoreKey], err = kp.jksTruststore([]byte(password)); err != nil {
+				return "", err
+			}
+		}
+	}
+	return hash, nil
+}
+
+// outputsHash returns the hash of the certificate, the CA bundle, the outputs and the keystore passwords.
+func (k *Kubernetes) outputsHash(passwords map[string]string) (string, error) {
+	inputs, err := json.Marshal(struct {
+		Certificate             []byte
+		PrivateKey              []byte
+		CA                      []byte
+		Keystores               *v1alpha1.CertificateKeystores
+		AdditionalOutputFormats []v1alpha1.CertificateOutputFormat
+		Passwords               map[string]string
+	}{k.cert.Certificate, k.cert.PrivateKey, k.ca, k.crt.Spec.Keystores, k.crt.Spec.AdditionalOutputFormats, passwords})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(inputs)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (k *Kubernetes) parseKeyPair() (*keyPair, error) {
+	chain, err := certcrypto.ParsePEMBundle(k.cert.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	key, err := certcrypto.ParsePEMPrivateKey(k.cert.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	kp := &keyPair{chain: chain, key: key, pkcs8: pkcs8}
+	if len(k.ca) != 0 {
+		if kp.ca, err = certcrypto.ParsePEMBundle(k.ca); err != nil {
+			return nil, err
+		}
+	}
+	return kp, nil
+}
+
+// keystorePasswords returns the passwords of the keystores of the certificate by their keys in the secret.
+func keystorePasswords(ctx context.Context, c client.Client, crt *v1alpha1.Certificate) (map[string]string, error) {
+	passwords := make(map[string]string, 2)
+	if crt.Spec.Keystores == nil {
+		return passwords, nil
+	}
+	for key, ks := range map[string]*v1alpha1.CertificateKeystore{
+		PKCS12KeystoreKey: crt.Spec.Keystores.PKCS12,
+		JKSKeystoreKey:    crt.Spec.Keystores.JKS,
+	} {
+		if ks == nil {
+			continue
+		}
+		password, err := keystorePassword(ctx, c, crt.Namespace, ks)
+		if err != nil {
+			return nil, err
+		}
+		passwords[key] = password
+	}
+	return passwords, nil
+}
+
+// keystorePassword returns the password of the keystore from the secret in the namespace of the certificate.
+func keystorePassword(ctx context.Context, c client.Client, namespace string, ks *v1alpha1.CertificateKeystore) (string, error) {
+	ref := ks.PasswordSecretRef
+	key := ref.Key
+	if key == "" {
+		key = defaultPasswordKey
+	}
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, secret); err != nil {
+		return "", err
+	}
+	password, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found in keystore password secret %s", key, ref.Name)
+	}
+	return string(password), nil
+}
+
+func (kp *keyPair) jksKeystore(password []byte) ([]byte, error) {
+	ks := keystore.New()
+	chain := make([]keystore.Certificate, 0, len(kp.chain))
+	for _, c := range kp.chain {
+		chain = append(chain, keystore.Certificate{Type: "X509", Content: c.Raw})
+	}
+	entry := keystore.PrivateKeyEntry{CreationTime: kp.chain[0].NotBefore, PrivateKey: kp.pkcs8, CertificateChain: chain}
+	if err := ks.SetPrivateKeyEntry(keystoreAlias, entry, password); err != nil {
+		return nil, err
+	}
+	return storeJKS(ks, password)
+}
+
+func (kp *keyPair) jksTruststore(password []byte) ([]byte, error) {
+	ks := keystore.New()
+	for i, c := range kp.ca {
+		entry := keystore.TrustedCertificateEntry{
+			CreationTime: c.NotBefore,
+			Certificate:  keystore.Certificate{Type: "X509", Content: c.Raw},
+		}
+		if err := ks.SetTrustedCertificateEntry(fmt.Sprintf("ca-%d", i), entry); err != nil {
+			return nil, err
+		}
+	}
+	return storeJKS(ks, password)
+}
+
+func storeJKS(ks keystore.KeyStore, password []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := ks.Store(buf, password); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
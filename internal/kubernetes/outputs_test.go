@@ -0,0 +1,174 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-logr/logr"
+	"github.com/onmetal/injector/api/v1alpha1"
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// testCertificate returns a certificate chain of a leaf and its CA and the private key of the leaf.
+func testCertificate(t *testing.T) (chainPEM, keyPEM, caPEM []byte) {
+	t.Helper()
+	a := assert.New(t)
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.NoError(err)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	a.NoError(err)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.NoError(err)
+	leaf := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leaf, ca, &key.PublicKey, caKey)
+	a.NoError(err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	a.NoError(err)
+	caPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+	chainPEM = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER}), caPEM...)
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return chainPEM, keyPEM, caPEM
+}
+
+func TestSecretOutputs(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	chainPEM, keyPEM, caPEM := testCertificate(t)
+	c := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "keystore", Namespace: "default"},
+		Data:       map[string][]byte{"password": []byte("changeit"), "jks": []byte("jks-password")},
+	}).Build()
+	crt := &v1alpha1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: v1alpha1.CertificateSpec{
+			SecretName: "app-tls",
+			Keystores: &v1alpha1.CertificateKeystores{
+				PKCS12: &v1alpha1.CertificateKeystore{PasswordSecretRef: v1alpha1.SecretKeySelector{Name: "keystore"}},
+				JKS: &v1alpha1.CertificateKeystore{
+					PasswordSecretRef: v1alpha1.SecretKeySelector{Name: "keystore", Key: "jks"},
+				},
+			},
+			AdditionalOutputFormats: []v1alpha1.CertificateOutputFormat{
+				{Type: v1alpha1.OutputFormatCombinedPEM},
+				{Type: v1alpha1.OutputFormatDER},
+			},
+		},
+	}
+	cert := &certificate.Resource{Certificate: chainPEM, PrivateKey: keyPEM}
+	k := New(ctx, c, logr.Discard(), cert, crt).WithCABundle(caPEM)
+	a.NoError(k.CreateOrUpdateSecretForCertificate())
+
+	sec := &corev1.Secret{}
+	a.NoError(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "app-tls"}, sec))
+	a.Equal(append(append([]byte{}, keyPEM...), chainPEM...), sec.Data[CombinedPEMKey])
+	leaf, err := x509.ParseCertificate(sec.Data[CertificateDERKey])
+	a.NoError(err)
+	a.Equal("example.com", leaf.Subject.CommonName)
+	_, err = x509.ParsePKCS8PrivateKey(sec.Data[PrivateKeyDERKey])
+	a.NoError(err)
+
+	key, p12Leaf, p12CA, err := pkcs12.DecodeChain(sec.Data[PKCS12KeystoreKey], "changeit")
+	a.NoError(err)
+	a.NotNil(key)
+	a.Equal(leaf.Raw, p12Leaf.Raw)
+	a.Len(p12CA, 1)
+	trusted, err := pkcs12.DecodeTrustStore(sec.Data[PKCS12TruststoreKey], "changeit")
+	a.NoError(err)
+	a.Len(trusted, 1)
+
+	ks := keystore.New()
+	a.NoError(ks.Load(bytes.NewReader(sec.Data[JKSKeystoreKey]), []byte("jks-password")))
+	entry, err := ks.GetPrivateKeyEntry(keystoreAlias, []byte("jks-password"))
+	a.NoError(err)
+	a.Len(entry.CertificateChain, 2)
+	ts := keystore.New()
+	a.NoError(ts.Load(bytes.NewReader(sec.Data[JKSTruststoreKey]), []byte("jks-password")))
+	a.Len(ts.Aliases(), 1)
+
+	resourceVersion := sec.ResourceVersion
+	a.NoError(k.CreateOrUpdateSecretForCertificate())
+	a.NoError(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "app-tls"}, sec))
+	a.Equal(resourceVersion, sec.ResourceVersion, "keystores aren't regenerated for the same inputs")
+
+	// changed outputs of an issued certificate are applied without a new certificate
+	crt.Spec.AdditionalOutputFormats = nil
+	a.NoError(k.CreateOrUpdateSecretForCertificate())
+	a.NoError(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "app-tls"}, sec))
+	a.NotContains(sec.Data, CombinedPEMKey)
+	a.NotContains(sec.Data, CertificateDERKey)
+	a.Contains(sec.Data, PKCS12KeystoreKey)
+	a.NotEqual(resourceVersion, sec.ResourceVersion)
+
+	crt.Spec.Keystores.JKS.PasswordSecretRef.Key = "missing"
+	a.Error(k.CreateOrUpdateSecretForCertificate())
+}
+
+func TestValidateOutputs(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	c := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "keystore", Namespace: "default"},
+		Data:       map[string][]byte{"password": []byte("changeit")},
+	}).Build()
+	crt := &v1alpha1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec:       v1alpha1.CertificateSpec{SecretName: "app-tls"},
+	}
+	a.NoError(ValidateOutputs(ctx, c, crt))
+
+	crt.Spec.Keystores = &v1alpha1.CertificateKeystores{
+		PKCS12: &v1alpha1.CertificateKeystore{PasswordSecretRef: v1alpha1.SecretKeySelector{Name: "keystore"}},
+	}
+	a.NoError(ValidateOutputs(ctx, c, crt))
+
+	crt.Spec.Keystores.JKS = &v1alpha1.CertificateKeystore{PasswordSecretRef: v1alpha1.SecretKeySelector{Name: "missing"}}
+	a.Error(ValidateOutputs(ctx, c, crt), "the password secret is missing")
+
+	crt.Spec.Keystores = nil
+	crt.Spec.AdditionalOutputFormats = []v1alpha1.CertificateOutputFormat{{Type: v1alpha1.OutputFormatDER}}
+	crt.Spec.CSR = &v1alpha1.CertificateSigningRequest{Request: []byte("csr")}
+	a.Error(ValidateOutputs(ctx, c, crt), "signing requests have no private key")
+}
@@ -17,38 +17,198 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/onmetal/injector/api/v1alpha1"
+	"github.com/onmetal/injector/app/injector/server"
+
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
 )
 
+// CertificateNameLabelKey is the label of the secret which names the certificate stored in it.
+const CertificateNameLabelKey = "cert.injector.ko/certificate-name"
+
+// FieldManager is the field manager of the secrets written by the controller.
+const FieldManager = "cert-injector"
+
+// managedKeys are the keys of the secret which are written by the controller, other keys are kept.
+var managedKeys = append([]string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey, server.CABundleKey}, outputKeys...)
+
+// CreateOrUpdateSecretForCertificate writes the certificate into its secret. Keys, labels and annotations
+// which aren't managed by the controller are kept, so other tools can share the secret.
 func (k *Kubernetes) CreateOrUpdateSecretForCertificate() error {
-	sec := k.prepareSecret()
-	err := k.Create(k.ctx, sec)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		sec := &corev1.Secret{}
+		err := k.Get(k.ctx, types.NamespacedName{Namespace: k.crt.Namespace, Name: k.crt.Spec.SecretName}, sec)
+		if apierr.IsNotFound(err) {
+			data, hash, err := k.secretData(nil)
+			if err != nil {
+				return err
+			}
+			sec = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: k.crt.Spec.SecretName, Namespace: k.crt.Namespace},
+				Type:       corev1.SecretTypeTLS,
+			}
+			if _, ok := data[corev1.TLSPrivateKeyKey]; !ok {
+				// TLS secrets must contain a private key
+				sec.Type = corev1.SecretTypeOpaque
+			}
+			if err := k.mutateSecret(sec, data, hash); err != nil {
+				return err
+			}
+			return k.Create(k.ctx, sec, client.FieldOwner(FieldManager))
+		}
+		if err != nil {
+			return err
+		}
+		data, hash, err := k.secretData(sec)
+		if err != nil {
+			return err
+		}
+		if _, ok := data[corev1.TLSPrivateKeyKey]; !ok && sec.Type == corev1.SecretTypeTLS {
+			return fmt.Errorf("secret %s of type %s requires a private key, it must be recreated for certificate signing requests",
+				sec.Name, corev1.SecretTypeTLS)
+		}
+		original := sec.DeepCopy()
+		if err := k.mutateSecret(sec, data, hash); err != nil {
+			return err
+		}
+		if equality.Semantic.DeepEqual(original, sec) {
+			return nil
+		}
+		return k.Update(k.ctx, sec, client.FieldOwner(FieldManager))
+	})
 	if err != nil {
-		if apierr.IsAlreadyExists(err) {
-			return k.Update(k.ctx, sec)
+		return err
+	}
+	return k.releasePreviousSecrets()
+}
+
+// PreviousSecret returns a secret which stored the certificate before its secret name changed, found by the
+// certificate name label. It returns a not found error if there is none.
+func PreviousSecret(ctx context.Context, c client.Client, crt *v1alpha1.Certificate) (*corev1.Secret, error) {
+	secrets, err := previousSecrets(ctx, c, crt)
+	if err != nil {
+		return nil, err
+	}
+	if len(secrets) == 0 {
+		return nil, apierr.NewNotFound(corev1.Resource("secrets"), crt.Spec.SecretName)
+	}
+	return &secrets[0], nil
+}
+
+func previousSecrets(ctx context.Context, c client.Client, crt *v1alpha1.Certificate) ([]corev1.Secret, error) {
+	list := &corev1.SecretList{}
+	if err := c.List(ctx, list, client.InNamespace(crt.Namespace),
+		client.MatchingLabels{CertificateNameLabelKey: crt.Name}); err != nil {
+		return nil, err
+	}
+	secrets := make([]corev1.Secret, 0, len(list.Items))
+	for _, sec := range list.Items {
+		if sec.Name != crt.Spec.SecretName {
+			secrets = append(secrets, sec)
 		}
+	}
+	return secrets, nil
+}
+
+// releasePreviousSecrets deletes the previous secrets of the certificate which it owns,
+// others are kept without the certificate name label.
+func (k *Kubernetes) releasePreviousSecrets() error {
+	secrets, err := previousSecrets(k.ctx, k.Client, k.crt)
+	if err != nil {
 		return err
 	}
-	return err
+	for i := range secrets {
+		sec := &secrets[i]
+		if metav1.IsControlledBy(sec, k.crt) {
+			if err := k.Delete(k.ctx, sec); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			k.log.Info("previous secret deleted", "name", sec.Name)
+			continue
+		}
+		delete(sec.Labels, CertificateNameLabelKey)
+		if err := k.Update(k.ctx, sec, client.FieldOwner(FieldManager)); err != nil {
+			return err
+		}
+		k.log.Info("previous secret released", "name", sec.Name)
+	}
+	return nil
+}
+
+// secretData returns the managed keys of the secret and the hash of its outputs. The private key is missing
+// for certificate signing requests, it's held by the requester.
+func (k *Kubernetes) secretData(current *corev1.Secret) (map[string][]byte, string, error) {
+	data := map[string][]byte{corev1.TLSCertKey: k.cert.Certificate}
+	if len(k.cert.PrivateKey) != 0 {
+		data[corev1.TLSPrivateKeyKey] = k.cert.PrivateKey
+	}
+	if len(k.ca) != 0 {
+		data[server.CABundleKey] = k.ca
+	}
+	hash, err := k.addOutputs(data, current)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, hash, nil
 }
 
-func (k *Kubernetes) prepareSecret() *corev1.Secret {
-	return &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("%s-tls", k.req.Name),
-			Namespace: k.req.Namespace,
-		},
-		Type: corev1.SecretTypeTLS,
-		Data: map[string][]byte{
-			corev1.TLSCertKey:       k.cert.Certificate,
-			corev1.TLSPrivateKeyKey: k.cert.PrivateKey,
-		},
+// mutateSecret sets the managed keys and the metadata of the certificate, managed keys which
+// aren't written anymore are removed.
+func (k *Kubernetes) mutateSecret(sec *corev1.Secret, data map[string][]byte, outputsHash string) error {
+	if sec.Data == nil {
+		sec.Data = make(map[string][]byte, len(data))
+	}
+	for _, key := range managedKeys {
+		if _, ok := data[key]; !ok {
+			delete(sec.Data, key)
+		}
+	}
+	for key, v := range data {
+		sec.Data[key] = v
+	}
+	if sec.Labels == nil {
+		sec.Labels = map[string]string{}
+	}
+	if tmpl := k.crt.Spec.SecretTemplate; tmpl != nil {
+		for key, v := range tmpl.Labels {
+			sec.Labels[key] = v
+		}
+		if len(tmpl.Annotations) != 0 && sec.Annotations == nil {
+			sec.Annotations = make(map[string]string, len(tmpl.Annotations))
+		}
+		for key, v := range tmpl.Annotations {
+			sec.Annotations[key] = v
+		}
+	}
+	sec.Labels[CertificateNameLabelKey] = k.crt.Name
+	if outputsHash != "" {
+		if sec.Annotations == nil {
+			sec.Annotations = make(map[string]string, 1)
+		}
+		sec.Annotations[OutputsHashAnnotationKey] = outputsHash
+	} else {
+		delete(sec.Annotations, OutputsHashAnnotationKey)
+	}
+	if k.crt.Spec.OwnSecret {
+		return controllerutil.SetControllerReference(k.crt, sec, k.Scheme())
+	}
+	refs := sec.OwnerReferences[:0]
+	for _, ref := range sec.OwnerReferences {
+		if ref.UID != k.crt.UID {
+			refs = append(refs, ref)
+		}
 	}
+	sec.OwnerReferences = refs
+	return nil
 }
 
 func CreateSecret(ctx context.Context, c client.Client, s *corev1.Secret) error {
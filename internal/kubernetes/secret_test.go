@@ -0,0 +1,179 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-logr/logr"
+	"github.com/onmetal/injector/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSecretTemplate(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	a.NoError(clientgoscheme.AddToScheme(scheme))
+	a.NoError(v1alpha1.AddToScheme(scheme))
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	crt := &v1alpha1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "1234"},
+		Spec: v1alpha1.CertificateSpec{
+			SecretName: "app-certificate",
+			SecretTemplate: &v1alpha1.CertificateSecretTemplate{
+				Labels:      map[string]string{"backup": "true", CertificateNameLabelKey: "other"},
+				Annotations: map[string]string{"reflector.v1.k8s.emberstack.com/reflection-allowed": "true"},
+			},
+			OwnSecret: true,
+		},
+	}
+	cert := &certificate.Resource{Certificate: []byte("cert"), PrivateKey: []byte("key")}
+	a.NoError(New(ctx, c, logr.Discard(), cert, crt).CreateOrUpdateSecretForCertificate())
+
+	sec := &corev1.Secret{}
+	a.NoError(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "app-certificate"}, sec))
+	a.Equal(map[string]string{"backup": "true", CertificateNameLabelKey: "app"}, sec.Labels)
+	a.Equal(crt.Spec.SecretTemplate.Annotations, sec.Annotations)
+	a.True(metav1.IsControlledBy(sec, crt))
+
+	crt.Spec.OwnSecret = false
+	crt.Spec.SecretTemplate = nil
+	a.NoError(New(ctx, c, logr.Discard(), cert, crt).CreateOrUpdateSecretForCertificate())
+	a.NoError(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "app-certificate"}, sec))
+	a.Equal(map[string]string{"backup": "true", CertificateNameLabelKey: "app"}, sec.Labels, "labels aren't dropped")
+	a.Empty(sec.OwnerReferences)
+}
+
+func TestSecretMerge(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	a.NoError(clientgoscheme.AddToScheme(scheme))
+	a.NoError(v1alpha1.AddToScheme(scheme))
+	foreignOwner := metav1.OwnerReference{APIVersion: "v1", Kind: "ConfigMap", Name: "owner", UID: "5678"}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "app-certificate", Namespace: "default",
+			Labels:          map[string]string{"team": "web"},
+			Annotations:     map[string]string{"replicator.v1.mittwald.de/replicate-to": "web"},
+			OwnerReferences: []metav1.OwnerReference{foreignOwner},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey: []byte("old"),
+			"dhparam.pem":     []byte("dhparam"),
+			CombinedPEMKey:    []byte("old"),
+		},
+	}).Build()
+	crt := &v1alpha1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "1234"},
+		Spec:       v1alpha1.CertificateSpec{SecretName: "app-certificate"},
+	}
+	cert := &certificate.Resource{Certificate: []byte("cert"), PrivateKey: []byte("key")}
+	a.NoError(New(ctx, c, logr.Discard(), cert, crt).CreateOrUpdateSecretForCertificate())
+
+	sec := &corev1.Secret{}
+	a.NoError(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "app-certificate"}, sec))
+	a.Equal(map[string][]byte{
+		corev1.TLSCertKey:       []byte("cert"),
+		corev1.TLSPrivateKeyKey: []byte("key"),
+		"dhparam.pem":           []byte("dhparam"),
+	}, sec.Data)
+	a.Equal(map[string]string{"team": "web", CertificateNameLabelKey: "app"}, sec.Labels)
+	a.Equal(map[string]string{"replicator.v1.mittwald.de/replicate-to": "web"}, sec.Annotations)
+	a.Equal([]metav1.OwnerReference{foreignOwner}, sec.OwnerReferences)
+	resourceVersion := sec.ResourceVersion
+
+	a.NoError(New(ctx, c, logr.Discard(), cert, crt).CreateOrUpdateSecretForCertificate())
+	a.NoError(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "app-certificate"}, sec))
+	a.Equal(resourceVersion, sec.ResourceVersion, "unchanged secrets aren't updated")
+}
+
+func TestSecretWithoutPrivateKey(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	a.NoError(clientgoscheme.AddToScheme(scheme))
+	a.NoError(v1alpha1.AddToScheme(scheme))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "tls", Namespace: "default"},
+		Type:       corev1.SecretTypeTLS,
+		Data:       map[string][]byte{corev1.TLSCertKey: []byte("old"), corev1.TLSPrivateKeyKey: []byte("old")},
+	}).Build()
+	crt := &v1alpha1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "1234"},
+		Spec:       v1alpha1.CertificateSpec{SecretName: "app-certificate"},
+	}
+	cert := &certificate.Resource{Certificate: []byte("cert")}
+	a.NoError(New(ctx, c, logr.Discard(), cert, crt).CreateOrUpdateSecretForCertificate())
+
+	sec := &corev1.Secret{}
+	a.NoError(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "app-certificate"}, sec))
+	a.Equal(corev1.SecretTypeOpaque, sec.Type)
+	a.Equal(map[string][]byte{corev1.TLSCertKey: []byte("cert")}, sec.Data)
+
+	crt.Spec.SecretName = "tls"
+	a.Error(New(ctx, c, logr.Discard(), cert, crt).CreateOrUpdateSecretForCertificate())
+
+	crt.Spec.SecretName = "app-certificate"
+	crt.Spec.AdditionalOutputFormats = []v1alpha1.CertificateOutputFormat{{Type: v1alpha1.OutputFormatDER}}
+	a.Error(New(ctx, c, logr.Discard(), cert, crt).CreateOrUpdateSecretForCertificate())
+}
+
+func TestSecretRename(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	a.NoError(clientgoscheme.AddToScheme(scheme))
+	a.NoError(v1alpha1.AddToScheme(scheme))
+	crt := &v1alpha1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "1234"},
+		Spec:       v1alpha1.CertificateSpec{SecretName: "owned", OwnSecret: true},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "shared", Namespace: "default",
+			Labels: map[string]string{CertificateNameLabelKey: "app", "team": "web"},
+		},
+		Data: map[string][]byte{corev1.TLSCertKey: []byte("cert")},
+	}).Build()
+	cert := &certificate.Resource{Certificate: []byte("cert"), PrivateKey: []byte("key")}
+	a.NoError(New(ctx, c, logr.Discard(), cert, crt).CreateOrUpdateSecretForCertificate())
+
+	sec := &corev1.Secret{}
+	a.NoError(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "shared"}, sec))
+	a.Equal(map[string]string{"team": "web"}, sec.Labels, "previous secrets which aren't owned are released")
+	a.Equal([]byte("cert"), sec.Data[corev1.TLSCertKey])
+
+	crt.Spec.SecretName = "renamed"
+	previous, err := PreviousSecret(ctx, c, crt)
+	a.NoError(err)
+	a.Equal("owned", previous.Name)
+	a.NoError(New(ctx, c, logr.Discard(), cert, crt).CreateOrUpdateSecretForCertificate())
+	a.NoError(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "renamed"}, sec))
+	a.True(apierr.IsNotFound(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "owned"}, sec)),
+		"owned previous secrets are deleted")
+	_, err = PreviousSecret(ctx, c, crt)
+	a.True(apierr.IsNotFound(err))
+}
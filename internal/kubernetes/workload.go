@@ -0,0 +1,227 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/onmetal/injector/api/v1alpha1"
+	"github.com/onmetal/injector/app/injector/server"
+	injerr "github.com/onmetal/injector/internal/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const injectEnabled = "true"
+
+// CertificateNameAnnotationKey names the certificate which injects its secret into the workload, so the
+// workload is released when it isn't a target anymore.
+const CertificateNameAnnotationKey = "cert.injector.ko/certificate-name"
+
+// InjectCertIntoWorkloads annotates the target workloads of the certificate, so the webhook mounts the secret,
+// and applies the rollout policy of the certificate.
+// The pod spec of pods and jobs can't be changed after creation, they get the secret only if they are
+// created with the annotations.
+func (k *Kubernetes) InjectCertIntoWorkloads() error {
+	if err := k.releaseWorkloads(); err != nil {
+		return err
+	}
+	if len(k.crt.Spec.Targets) == 0 {
+		return injerr.NotRequired()
+	}
+	if k.crt.Spec.RolloutPolicy == v1alpha1.RolloutPolicySignal && k.crt.Spec.SignalProcess == "" {
+		return fmt.Errorf("rollout policy %s requires a signal process", v1alpha1.RolloutPolicySignal)
+	}
+	for _, target := range k.crt.Spec.Targets {
+		kind := target.Kind
+		if kind == "" {
+			kind = v1alpha1.WorkloadKindDeployment
+		}
+		obj := newWorkload(kind)
+		if obj == nil {
+			k.log.Info("workload kind not supported", "kind", kind)
+			continue
+		}
+		if err := k.getWorkload(target.Name, obj); err != nil {
+			if apierr.IsNotFound(err) {
+				k.log.Info("workload not exist", "kind", kind, "name", target.Name)
+				continue
+			}
+			return err
+		}
+		original := obj.DeepCopyObject()
+		k.annotateWorkload(obj)
+		if equality.Semantic.DeepEqual(original, obj) {
+			continue
+		}
+		if err := k.Update(k.ctx, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// annotateWorkload sets the annotations of the webhook and stamps the hash of the certificate into
+// the pod template if the workload is restarted on renewal.
+func (k *Kubernetes) annotateWorkload(obj client.Object) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string, 3)
+	}
+	annotations[server.AdmissionWebhookAnnotationInjectKey] = injectEnabled
+	annotations[server.AdmissionWebhookAnnotationCertKey] = k.crt.Spec.SecretName
+	annotations[CertificateNameAnnotationKey] = k.crt.Name
+	if k.crt.Spec.RolloutPolicy == v1alpha1.RolloutPolicySignal {
+		annotations[server.AdmissionWebhookAnnotationSignalProcessKey] = k.crt.Spec.SignalProcess
+	} else {
+		delete(annotations, server.AdmissionWebhookAnnotationSignalProcessKey)
+	}
+	obj.SetAnnotations(annotations)
+
+	tmpl := podTemplate(obj)
+	if tmpl == nil {
+		return
+	}
+	if k.crt.Spec.RolloutPolicy != v1alpha1.RolloutPolicyRestart {
+		delete(tmpl.Annotations, server.CertificateHashAnnotationKey)
+		return
+	}
+	if tmpl.Annotations == nil {
+		tmpl.Annotations = make(map[string]string, 1)
+	}
+	tmpl.Annotations[server.CertificateHashAnnotationKey] = certificateHash(k.cert.Certificate)
+}
+
+// releaseWorkloads removes the annotations and the mounted secret of the certificate from workloads which aren't
+// targets anymore. Pods and jobs keep the secret, their pod spec can't be changed.
+func (k *Kubernetes) releaseWorkloads() error {
+	targets := make(map[string]struct{}, len(k.crt.Spec.Targets))
+	for _, target := range k.crt.Spec.Targets {
+		kind := target.Kind
+		if kind == "" {
+			kind = v1alpha1.WorkloadKindDeployment
+		}
+		targets[kind+"/"+target.Name] = struct{}{}
+	}
+	for _, kind := range []string{v1alpha1.WorkloadKindDeployment, v1alpha1.WorkloadKindStatefulSet,
+		v1alpha1.WorkloadKindDaemonSet, v1alpha1.WorkloadKindCronJob} {
+		list := newWorkloadList(kind)
+		if err := k.List(k.ctx, list, client.InNamespace(k.crt.Namespace)); err != nil {
+			return err
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			obj, ok := item.(client.Object)
+			if !ok || obj.GetAnnotations()[CertificateNameAnnotationKey] != k.crt.Name {
+				continue
+			}
+			if _, ok := targets[kind+"/"+obj.GetName()]; ok {
+				continue
+			}
+			releaseWorkload(obj)
+			if err := k.Update(k.ctx, obj); err != nil {
+				return err
+			}
+			k.log.Info("workload released", "kind", kind, "name", obj.GetName())
+		}
+	}
+	return nil
+}
+
+// releaseWorkload removes the annotations of the certificate and unmounts its secret from the pod template.
+func releaseWorkload(obj client.Object) {
+	annotations := obj.GetAnnotations()
+	for _, key := range []string{server.AdmissionWebhookAnnotationInjectKey, server.AdmissionWebhookAnnotationCertKey,
+		server.AdmissionWebhookAnnotationSignalProcessKey, CertificateNameAnnotationKey} {
+		delete(annotations, key)
+	}
+	obj.SetAnnotations(annotations)
+	if tmpl := podTemplate(obj); tmpl != nil {
+		delete(tmpl.Annotations, server.CertificateHashAnnotationKey)
+		server.UnmountCertificate(&tmpl.Spec)
+	}
+}
+
+// podTemplate returns the pod template of the workload, nil if it has none or it can't be changed.
+func podTemplate(obj client.Object) *corev1.PodTemplateSpec {
+	switch w := obj.(type) {
+	case *appsv1.Deployment:
+		return &w.Spec.Template
+	case *appsv1.StatefulSet:
+		return &w.Spec.Template
+	case *appsv1.DaemonSet:
+		return &w.Spec.Template
+	case *batchv1.CronJob:
+		return &w.Spec.JobTemplate.Spec.Template
+	}
+	return nil
+}
+
+func certificateHash(pem []byte) string {
+	sum := sha256.Sum256(pem)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// newWorkload returns an empty object of the workload kind, nil if the kind isn't supported.
+func newWorkload(kind string) client.Object {
+	switch kind {
+	case v1alpha1.WorkloadKindDeployment:
+		return &appsv1.Deployment{}
+	case v1alpha1.WorkloadKindStatefulSet:
+		return &appsv1.StatefulSet{}
+	case v1alpha1.WorkloadKindDaemonSet:
+		return &appsv1.DaemonSet{}
+	case v1alpha1.WorkloadKindJob:
+		return &batchv1.Job{}
+	case v1alpha1.WorkloadKindCronJob:
+		return &batchv1.CronJob{}
+	case v1alpha1.WorkloadKindPod:
+		return &corev1.Pod{}
+	}
+	return nil
+}
+
+// newWorkloadList returns an empty list of the workload kind with a pod template, nil for other kinds.
+func newWorkloadList(kind string) client.ObjectList {
+	switch kind {
+	case v1alpha1.WorkloadKindDeployment:
+		return &appsv1.DeploymentList{}
+	case v1alpha1.WorkloadKindStatefulSet:
+		return &appsv1.StatefulSetList{}
+	case v1alpha1.WorkloadKindDaemonSet:
+		return &appsv1.DaemonSetList{}
+	case v1alpha1.WorkloadKindCronJob:
+		return &batchv1.CronJobList{}
+	}
+	return nil
+}
+
+func (k *Kubernetes) getWorkload(name string, obj client.Object) error {
+	key := types.NamespacedName{
+		Namespace: k.crt.Namespace,
+		Name:      name,
+	}
+	return k.Get(k.ctx, key, obj)
+}
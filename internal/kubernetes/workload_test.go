@@ -0,0 +1,135 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-acme/lego/v4/certificate"
+	"github.com/go-logr/logr"
+	"github.com/onmetal/injector/api/v1alpha1"
+	"github.com/onmetal/injector/app/injector/server"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestInjectCertIntoWorkloads(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	meta := metav1.ObjectMeta{Name: "app", Namespace: "default"}
+	c := fake.NewClientBuilder().WithObjects(
+		&appsv1.StatefulSet{ObjectMeta: meta},
+		&batchv1.CronJob{ObjectMeta: meta},
+	).Build()
+	crt := &v1alpha1.Certificate{
+		ObjectMeta: meta,
+		Spec: v1alpha1.CertificateSpec{
+			SecretName:    "app-tls",
+			RolloutPolicy: v1alpha1.RolloutPolicyRestart,
+			Targets: []v1alpha1.WorkloadReference{
+				{Kind: v1alpha1.WorkloadKindStatefulSet, Name: "app"},
+				{Kind: v1alpha1.WorkloadKindCronJob, Name: "app"},
+				{Kind: v1alpha1.WorkloadKindDaemonSet, Name: "missing"},
+			},
+		},
+	}
+	k := New(ctx, c, logr.Discard(), &certificate.Resource{Certificate: []byte("first")}, crt)
+	a.NoError(k.InjectCertIntoWorkloads())
+
+	sts := &appsv1.StatefulSet{}
+	a.NoError(c.Get(ctx, client.ObjectKeyFromObject(crt), sts))
+	a.Equal("true", sts.Annotations[server.AdmissionWebhookAnnotationInjectKey])
+	a.Equal("app-tls", sts.Annotations[server.AdmissionWebhookAnnotationCertKey])
+	first := sts.Spec.Template.Annotations[server.CertificateHashAnnotationKey]
+	a.NotEmpty(first)
+	cj := &batchv1.CronJob{}
+	a.NoError(c.Get(ctx, client.ObjectKeyFromObject(crt), cj))
+	a.Equal(first, cj.Spec.JobTemplate.Spec.Template.Annotations[server.CertificateHashAnnotationKey])
+
+	// a renewed certificate rolls out the workload
+	k = New(ctx, c, logr.Discard(), &certificate.Resource{Certificate: []byte("second")}, crt)
+	a.NoError(k.InjectCertIntoWorkloads())
+	a.NoError(c.Get(ctx, client.ObjectKeyFromObject(crt), sts))
+	a.NotEqual(first, sts.Spec.Template.Annotations[server.CertificateHashAnnotationKey])
+
+	crt.Spec.RolloutPolicy = v1alpha1.RolloutPolicySignal
+	a.Error(k.InjectCertIntoWorkloads(), "signal process is required")
+	crt.Spec.SignalProcess = "haproxy"
+	a.NoError(k.InjectCertIntoWorkloads())
+	a.NoError(c.Get(ctx, client.ObjectKeyFromObject(crt), sts))
+	a.Equal("haproxy", sts.Annotations[server.AdmissionWebhookAnnotationSignalProcessKey])
+	a.NotContains(sts.Spec.Template.Annotations, server.CertificateHashAnnotationKey)
+}
+
+func TestReleaseWorkloads(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	template := corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+		Containers: []corev1.Container{{
+			Name:         "app",
+			VolumeMounts: []corev1.VolumeMount{{Name: "tls-certificates", MountPath: "/certs"}},
+		}},
+		Volumes: []corev1.Volume{{Name: "tls-certificates"}},
+	}}
+	c := fake.NewClientBuilder().WithObjects(
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "removed", Namespace: "default", Annotations: map[string]string{
+				server.AdmissionWebhookAnnotationInjectKey: "true",
+				server.AdmissionWebhookAnnotationCertKey:   "app-tls",
+				CertificateNameAnnotationKey:               "app",
+			}},
+			Spec: appsv1.DeploymentSpec{Template: template},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default", Annotations: map[string]string{
+				server.AdmissionWebhookAnnotationInjectKey: "true",
+				server.AdmissionWebhookAnnotationCertKey:   "other-tls",
+				CertificateNameAnnotationKey:               "other",
+			}},
+			Spec: appsv1.DeploymentSpec{Template: template},
+		},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "added", Namespace: "default"}},
+	).Build()
+	crt := &v1alpha1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: v1alpha1.CertificateSpec{
+			SecretName: "app-tls",
+			Targets:    []v1alpha1.WorkloadReference{{Name: "added"}},
+		},
+	}
+	k := New(ctx, c, logr.Discard(), &certificate.Resource{Certificate: []byte("cert")}, crt)
+	a.NoError(k.InjectCertIntoWorkloads())
+
+	removed := &appsv1.Deployment{}
+	a.NoError(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "removed"}, removed))
+	a.Empty(removed.Annotations)
+	a.Empty(removed.Spec.Template.Spec.Volumes)
+	a.Empty(removed.Spec.Template.Spec.Containers[0].VolumeMounts)
+
+	other := &appsv1.Deployment{}
+	a.NoError(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "other"}, other))
+	a.Equal("other-tls", other.Annotations[server.AdmissionWebhookAnnotationCertKey])
+	a.Len(other.Spec.Template.Spec.Volumes, 1)
+
+	added := &appsv1.Deployment{}
+	a.NoError(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "added"}, added))
+	a.Equal("app-tls", added.Annotations[server.AdmissionWebhookAnnotationCertKey])
+	a.Equal("app", added.Annotations[CertificateNameAnnotationKey])
+}
@@ -15,14 +15,24 @@ package renewal
 
 import (
 	"github.com/go-acme/lego/v4/certificate"
-	"github.com/onmetal/injector/internal/issuer/solver"
+	"github.com/onmetal/injector/internal/issuer"
 )
 
 func (c *certs) RegisterChallengeProvider() error {
-	s := solver.New(c.ctx, c.k8sClient, c.log, c.svc)
-	return c.legoClient.Challenge.SetHTTP01Provider(s)
+	return issuer.RegisterChallengeProvider(c.ctx, c.k8sClient, c.log, c.legoClient, c.crt, c.gi)
 }
 
+// Renew obtains a new certificate for the domains, the private key is reused according to its rotation policy.
+// Certificates of signing requests are renewed for the current request.
 func (c *certs) Renew() (*certificate.Resource, error) {
-	return c.legoClient.Certificate.Renew(*c.cert, true, false, "")
+	if c.crt.Spec.CSR != nil {
+		cert, err := issuer.ObtainForRequest(c.ctx, c.k8sClient, c.legoClient, c.crt)
+		return cert, issuer.WithRetryAfter(c.config, err)
+	}
+	key, err := issuer.RenewalPrivateKey(c.crt, c.cert.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := issuer.ObtainWithPrivateKey(c.legoClient, c.crt, key)
+	return cert, issuer.WithRetryAfter(c.config, err)
 }
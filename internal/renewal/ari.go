@@ -0,0 +1,130 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package renewal
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	injerr "github.com/onmetal/injector/internal/errors"
+)
+
+// Bounds of the interval the renewal information is fetched again in.
+const (
+	defaultRenewalInfoRetryAfter = 6 * time.Hour
+	minRenewalInfoRetryAfter     = time.Hour
+	maxRenewalInfoRetryAfter     = 24 * time.Hour
+)
+
+// RenewalInfo is the renewal window the ACME server suggests for a certificate (ACME Renewal Information, RFC 9773).
+type RenewalInfo struct {
+	SuggestedWindow struct {
+		Start time.Time `json:"start"`
+		End   time.Time `json:"end"`
+	} `json:"suggestedWindow"`
+	ExplanationURL string `json:"explanationURL,omitempty"`
+	// RetryAfter is the interval after which the renewal information is fetched again.
+	RetryAfter time.Duration `json:"-"`
+}
+
+// RenewalTime returns the time inside the suggested window at which the certificate is renewed.
+// Like RenewalTime of the lifetime, it's derived from the serial number to be stable.
+func (ri *RenewalInfo) RenewalTime(x509Cert *x509.Certificate) time.Time {
+	window := ri.SuggestedWindow.End.Sub(ri.SuggestedWindow.Start)
+	offset := time.Duration(float64(window) * fraction(x509Cert.SerialNumber.Bytes()))
+	return ri.SuggestedWindow.Start.Add(offset).Truncate(time.Second)
+}
+
+// GetRenewalInfo fetches the renewal information of the certificate from the ACME server of the directory.
+// It returns a NotExist error if the server doesn't support ACME Renewal Information.
+func GetRenewalInfo(ctx context.Context, httpClient *http.Client, directoryURL string, x509Cert *x509.Certificate) (*RenewalInfo, error) {
+	id, err := CertID(x509Cert)
+	if err != nil {
+		return nil, err
+	}
+	var dir struct {
+		RenewalInfo string `json:"renewalInfo"`
+	}
+	if _, err := getJSON(ctx, httpClient, directoryURL, &dir); err != nil {
+		return nil, err
+	}
+	if dir.RenewalInfo == "" {
+		return nil, injerr.NotExist("renewalInfo endpoint")
+	}
+
+	ri := &RenewalInfo{}
+	resp, err := getJSON(ctx, httpClient, strings.TrimSuffix(dir.RenewalInfo, "/")+"/"+id, ri)
+	if err != nil {
+		return nil, err
+	}
+	if !ri.SuggestedWindow.End.After(ri.SuggestedWindow.Start) {
+		return nil, fmt.Errorf("invalid suggested window %s - %s", ri.SuggestedWindow.Start, ri.SuggestedWindow.End)
+	}
+	ri.RetryAfter = retryAfter(resp.Header.Get("Retry-After"))
+	return ri, nil
+}
+
+// CertID returns the unique identifier of the certificate used by ACME Renewal Information,
+// the base64url encoded authority key identifier and serial number separated by a dot.
+func CertID(x509Cert *x509.Certificate) (string, error) {
+	if len(x509Cert.AuthorityKeyId) == 0 {
+		return "", injerr.NotExist("authority key identifier")
+	}
+	serial := x509Cert.SerialNumber.Bytes()
+	// DER encoding of a positive integer
+	if len(serial) == 0 || serial[0]&0x80 != 0 {
+		serial = append([]byte{0}, serial...)
+	}
+	return base64.RawURLEncoding.EncodeToString(x509Cert.AuthorityKeyId) + "." +
+		base64.RawURLEncoding.EncodeToString(serial), nil
+}
+
+func getJSON(ctx context.Context, httpClient *http.Client, url string, v interface{}) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s of %s", resp.Status, url)
+	}
+	return resp, json.NewDecoder(resp.Body).Decode(v)
+}
+
+func retryAfter(header string) time.Duration {
+	d := defaultRenewalInfoRetryAfter
+	if seconds, err := strconv.Atoi(header); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if t, err := http.ParseTime(header); err == nil {
+		d = time.Until(t)
+	}
+	switch {
+	case d < minRenewalInfoRetryAfter:
+		return minRenewalInfoRetryAfter
+	case d > maxRenewalInfoRetryAfter:
+		return maxRenewalInfoRetryAfter
+	}
+	return d
+}
@@ -0,0 +1,77 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package renewal
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	injerr "github.com/onmetal/injector/internal/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// ariCert is the example certificate of RFC 9773.
+var ariCert = &x509.Certificate{
+	AuthorityKeyId: []byte{0x69, 0x88, 0x5B, 0x6B, 0x87, 0x46, 0x40, 0x41, 0xE1, 0xB3,
+		0x7B, 0x84, 0x7B, 0xA0, 0xAE, 0x2C, 0xDE, 0x01, 0xC8, 0xD4},
+	SerialNumber: big.NewInt(0x87654321),
+}
+
+func TestCertID(t *testing.T) {
+	id, err := CertID(ariCert)
+	assert.NoError(t, err)
+	assert.Equal(t, "aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE", id)
+}
+
+func TestGetRenewalInfo(t *testing.T) {
+	a := assert.New(t)
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	mux.HandleFunc("/directory", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"renewalInfo": "%s/renewal-info"}`, srv.URL)
+	})
+	mux.HandleFunc("/renewal-info/aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "21600")
+		fmt.Fprint(w, `{"suggestedWindow": {"start": "2025-01-02T04:00:00Z", "end": "2025-01-03T04:00:00Z"}}`)
+	})
+	mux.HandleFunc("/no-ari", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	})
+
+	ri, err := GetRenewalInfo(context.Background(), srv.Client(), srv.URL+"/directory", ariCert)
+	if !a.NoError(err) {
+		t.FailNow()
+	}
+	a.Equal(6*time.Hour, ri.RetryAfter)
+	renewAt := ri.RenewalTime(ariCert)
+	a.False(renewAt.Before(ri.SuggestedWindow.Start))
+	a.True(renewAt.Before(ri.SuggestedWindow.End))
+
+	_, err = GetRenewalInfo(context.Background(), srv.Client(), srv.URL+"/no-ari", ariCert)
+	a.True(injerr.IsNotExist(err))
+}
+
+func TestRetryAfter(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(defaultRenewalInfoRetryAfter, retryAfter(""))
+	a.Equal(minRenewalInfoRetryAfter, retryAfter("60"))
+	a.Equal(maxRenewalInfoRetryAfter, retryAfter("604800"))
+}
@@ -15,19 +15,17 @@ package renewal
 
 import (
 	"context"
-	"crypto/ecdsa"
-	"fmt"
 
-	"github.com/onmetal/injector/internal/issuer/solver"
+	"github.com/onmetal/injector/api/v1alpha1"
 
 	"github.com/go-acme/lego/v4/registration"
 
+	apierr "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 
 	"github.com/go-acme/lego/v4/certificate"
 	"github.com/go-acme/lego/v4/lego"
 	"github.com/go-logr/logr"
-	injerr "github.com/onmetal/injector/internal/errors"
 	"github.com/onmetal/injector/internal/issuer"
 	"github.com/onmetal/injector/internal/kubernetes"
 	corev1 "k8s.io/api/core/v1"
@@ -43,65 +41,71 @@ type Renewer interface {
 type certs struct {
 	ctx        context.Context
 	legoClient *lego.Client
+	config     *lego.Config
 	k8sClient  client.Client
 	log        logr.Logger
-	svc        *corev1.Service
+	crt        *v1alpha1.Certificate
+	gi         v1alpha1.GenericIssuer
 	cert       *certificate.Resource
 }
 
-func New(ctx context.Context, k8sClient client.Client, l logr.Logger, req ctrl.Request) (Renewer, error) {
-	service, err := kubernetes.GetService(ctx, k8sClient, req)
+func New(ctx context.Context, k8sClient client.Client, l logr.Logger, crt *v1alpha1.Certificate) (Renewer, error) {
+	gi, err := issuer.GetIssuer(ctx, k8sClient, crt)
 	if err != nil {
 		return nil, err
 	}
-	if !isRequired(service.Annotations) {
-		return nil, injerr.NotRequired()
-	}
-	caURL := issuer.GetConfig(issuer.CaURLAnnotationKey, service.Annotations)
-	email := issuer.GetConfig(issuer.EmailAnnotationKey, service.Annotations)
+	acme := gi.GetSpec().ACME
 
-	currentCertificate, err := getCurrentCertificate(ctx, k8sClient, req)
+	currentCertificate, err := GetCurrentCertificate(ctx, k8sClient, crt)
 	if err != nil {
 		return nil, err
 	}
 
-	privateKey, err := issuer.GetPrivateKey(ctx, k8sClient, req.Namespace)
+	privateKey, err := issuer.GetPrivateKey(ctx, k8sClient, gi)
 	if err != nil {
 		return nil, err
 	}
-	user := getUser(email, privateKey)
-	config := issuer.NewConfig(user, caURL)
-
-	legoClient, err := lego.NewClient(config)
+	user := issuer.NewUser(acme.Email, privateKey)
+	user.Registration = issuer.AccountRegistration(gi, privateKey)
+	config, err := issuer.NewConfig(user, acme)
 	if err != nil {
 		return nil, err
 	}
-	reg, err := getRegistration(legoClient)
+
+	legoClient, err := lego.NewClient(config)
 	if err != nil {
 		return nil, err
 	}
-	user.Registration = reg
+	if user.Registration == nil {
+		reg, err := getRegistration(legoClient)
+		if err != nil {
+			return nil, issuer.WithRetryAfter(config, err)
+		}
+		user.Registration = reg
+	}
 	return &certs{
 		ctx:        ctx,
 		legoClient: legoClient,
+		config:     config,
 		k8sClient:  k8sClient,
-		svc:        service,
 		log:        l,
+		crt:        crt,
+		gi:         gi,
 		cert:       currentCertificate,
 	}, nil
 }
 
-func isRequired(m map[string]string) bool {
-	v, ok := m[solver.InjectAnnotationKey]
-	return ok && v == "done"
-}
-
-func getCurrentCertificate(ctx context.Context, c client.Client, req ctrl.Request) (*certificate.Resource, error) {
+// GetCurrentCertificate returns the certificate stored in the secret of the certificate resource. If the secret
+// doesn't exist, the certificate is read from its previous secret, so a changed secret name doesn't order a new one.
+func GetCurrentCertificate(ctx context.Context, c client.Client, crt *v1alpha1.Certificate) (*certificate.Resource, error) {
 	secObj := ctrl.Request{NamespacedName: types.NamespacedName{
-		Namespace: req.Namespace,
-		Name:      fmt.Sprintf("%s-tls", req.Name),
+		Namespace: crt.Namespace,
+		Name:      crt.Spec.SecretName,
 	}}
 	secret, err := kubernetes.GetSecret(ctx, c, secObj)
+	if apierr.IsNotFound(err) {
+		secret, err = kubernetes.PreviousSecret(ctx, c, crt)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -111,13 +115,6 @@ func getCurrentCertificate(ctx context.Context, c client.Client, req ctrl.Reques
 	return cert, nil
 }
 
-func getUser(email string, privateKey *ecdsa.PrivateKey) *issuer.User {
-	return &issuer.User{
-		Email: email,
-		Key:   privateKey,
-	}
-}
-
 func getRegistration(c *lego.Client) (*registration.Resource, error) {
 	return c.Registration.ResolveAccountByKey()
 }
@@ -0,0 +1,55 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package renewal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/onmetal/injector/api/v1alpha1"
+	"github.com/onmetal/injector/internal/kubernetes"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGetCurrentCertificate(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	c := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "app-tls", Namespace: "default",
+			Labels: map[string]string{kubernetes.CertificateNameLabelKey: "app"},
+		},
+		Data: map[string][]byte{corev1.TLSCertKey: []byte("cert"), corev1.TLSPrivateKeyKey: []byte("key")},
+	}).Build()
+	crt := &v1alpha1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec:       v1alpha1.CertificateSpec{SecretName: "app-tls"},
+	}
+	cert, err := GetCurrentCertificate(ctx, c, crt)
+	a.NoError(err)
+	a.Equal([]byte("cert"), cert.Certificate)
+
+	crt.Spec.SecretName = "renamed"
+	cert, err = GetCurrentCertificate(ctx, c, crt)
+	a.NoError(err)
+	a.Equal([]byte("key"), cert.PrivateKey, "a renamed secret keeps the certificate")
+
+	crt.Name = "other"
+	_, err = GetCurrentCertificate(ctx, c, crt)
+	a.True(apierr.IsNotFound(err))
+}
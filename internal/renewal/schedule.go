@@ -0,0 +1,74 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package renewal
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"math"
+	"time"
+
+	"github.com/onmetal/injector/api/v1alpha1"
+)
+
+const (
+	defaultRenewBeforePercentage = 33
+	// maxRenewBeforePercentage leaves room for the jitter, so certificates aren't due once they are issued.
+	maxRenewBeforePercentage = 95
+	// jitterDivisor spreads the renewal of certificates issued at the same time over
+	// the last twentieth of their renewal window.
+	jitterDivisor = 20
+)
+
+// RenewalTime returns the time at which the certificate has to be renewed.
+// The time is derived from the lifetime of the certificate and a jitter based on its serial number,
+// so it's the same after a restart of the controller while certificates issued together are renewed apart.
+func RenewalTime(x509Cert *x509.Certificate, crt *v1alpha1.Certificate) time.Time {
+	lifetime := x509Cert.NotAfter.Sub(x509Cert.NotBefore)
+	renewBefore := RenewBefore(lifetime, crt)
+	jitter := time.Duration(float64(renewBefore/jitterDivisor) * fraction(x509Cert.SerialNumber.Bytes()))
+	renewAt := x509Cert.NotAfter.Add(-renewBefore - jitter)
+	if renewAt.Before(x509Cert.NotBefore) {
+		renewAt = x509Cert.NotBefore
+	}
+	// the status stores seconds only
+	return renewAt.Truncate(time.Second)
+}
+
+// RenewBefore returns the duration before the expiration at which a certificate with the lifetime is renewed.
+// It's at most 95% of the lifetime.
+func RenewBefore(lifetime time.Duration, crt *v1alpha1.Certificate) time.Duration {
+	limit := time.Duration(int64(lifetime) / 100 * maxRenewBeforePercentage)
+	if rb := crt.Spec.RenewBefore; rb != nil && rb.Duration > 0 && rb.Duration < lifetime {
+		if rb.Duration > limit {
+			return limit
+		}
+		return rb.Duration
+	}
+	percentage := int64(defaultRenewBeforePercentage)
+	if p := crt.Spec.RenewBeforePercentage; p != nil && *p > 0 && *p < 100 {
+		percentage = int64(*p)
+	}
+	if percentage > maxRenewBeforePercentage {
+		return limit
+	}
+	return time.Duration(int64(lifetime) / 100 * percentage)
+}
+
+// fraction maps the bytes to a number in [0, 1).
+func fraction(b []byte) float64 {
+	sum := sha256.Sum256(b)
+	return float64(binary.BigEndian.Uint64(sum[:8])) / (math.MaxUint64 + 1.0)
+}
@@ -0,0 +1,76 @@
+/*
+Copyright (c) 2021 T-Systems International GmbH, SAP SE or an SAP affiliate company. All right reserved
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package renewal
+
+import (
+	"crypto/x509"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/onmetal/injector/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+func TestRenewBefore(t *testing.T) {
+	a := assert.New(t)
+	lifetime := 90 * 24 * time.Hour
+	crt := &v1alpha1.Certificate{}
+
+	a.Equal(lifetime/100*33, RenewBefore(lifetime, crt))
+
+	crt.Spec.RenewBeforePercentage = pointer.Int32(50)
+	a.Equal(lifetime/2, RenewBefore(lifetime, crt))
+
+	crt.Spec.RenewBefore = &metav1.Duration{Duration: 30 * 24 * time.Hour}
+	a.Equal(30*24*time.Hour, RenewBefore(lifetime, crt))
+
+	// a short-lived certificate falls back to the percentage
+	a.Equal(3*time.Hour, RenewBefore(6*time.Hour, crt))
+
+	crt.Spec.RenewBefore = &metav1.Duration{Duration: 89 * 24 * time.Hour}
+	a.Equal(lifetime/100*95, RenewBefore(lifetime, crt))
+}
+
+func TestRenewalTime(t *testing.T) {
+	a := assert.New(t)
+	notBefore := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	crt := &v1alpha1.Certificate{Spec: v1alpha1.CertificateSpec{RenewBefore: &metav1.Duration{Duration: 30 * 24 * time.Hour}}}
+	cert := &x509.Certificate{
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(90 * 24 * time.Hour),
+		SerialNumber: big.NewInt(42),
+	}
+
+	renewAt := RenewalTime(cert, crt)
+	latest := cert.NotAfter.Add(-30 * 24 * time.Hour)
+	a.False(renewAt.After(latest))
+	a.True(renewAt.After(latest.Add(-30 * 24 * time.Hour / jitterDivisor)))
+	a.Equal(renewAt, RenewalTime(cert, crt), "renewal time has to be stable")
+
+	other := *cert
+	other.SerialNumber = big.NewInt(43)
+	a.NotEqual(renewAt, RenewalTime(&other, crt), "certificates issued together have to be spread")
+
+	for _, crt := range []*v1alpha1.Certificate{
+		{Spec: v1alpha1.CertificateSpec{RenewBeforePercentage: pointer.Int32(99)}},
+		{Spec: v1alpha1.CertificateSpec{RenewBefore: &metav1.Duration{Duration: 89 * 24 * time.Hour}}},
+	} {
+		renewAt := RenewalTime(cert, crt)
+		a.True(renewAt.After(cert.NotBefore), "certificates mustn't be due once they are issued")
+		a.False(renewAt.After(cert.NotAfter.Add(-85*24*time.Hour)), "renewBefore is capped at 95 percent of the lifetime")
+	}
+}